@@ -0,0 +1,33 @@
+package gc
+
+import (
+	"image"
+
+	"github.com/bodgit/gc/internal/texture"
+)
+
+// Banner returns the 96x32 banner image for the file, or nil if the file
+// doesn't have one or it is in an unknown format. A CI8 banner is returned as
+// an *image.Paletted and an RGB5A3 banner as an *image.NRGBA.
+func (f *File) Banner() (image.Image, error) {
+	if f.e.BannerFormat.size() == 0 || f.e.ImageDataOffset == noOffset {
+		return nil, nil //nolint:nilnil
+	}
+
+	b := make([]byte, f.e.BannerFormat.size())
+
+	if err := f.readAt(b, f.e.ImageDataOffset, entryImageDataOffset, ErrImageDataOffsetOutOfRange); err != nil {
+		return nil, err
+	}
+
+	if f.e.BannerFormat.Format() == BannerRGB5A3 {
+		return texture.DecodeRGB5A3(b, bannerWidth, bannerHeight) //nolint:wrapcheck
+	}
+
+	p, err := texture.DecodePalette(b[bannerWidth*bannerHeight:])
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return texture.DecodeCI8(b, p, bannerWidth, bannerHeight) //nolint:wrapcheck
+}
@@ -8,7 +8,23 @@ import (
 	"github.com/bodgit/gc/internal/hash"
 )
 
-var errBadBlockMapChecksum = errors.New("bad block map checksum")
+// ErrBadBlockMapChecksum is returned when the checksum of a block allocation
+// map doesn't match its contents.
+var ErrBadBlockMapChecksum = errors.New("bad block map checksum")
+
+var (
+	// ErrBlockChainLoop is returned when the chain of blocks for a file
+	// loops back on itself.
+	ErrBlockChainLoop = errors.New("loop in block chain")
+	// ErrBlockOutOfRange is returned when the chain of blocks for a file
+	// refers to a block that is reserved or lies outside the card.
+	ErrBlockOutOfRange = errors.New("block out of range")
+	// ErrFileLengthMismatch is returned when the length of the chain of
+	// blocks for a file does not match the length in its directory entry.
+	ErrFileLengthMismatch = errors.New("file length does not match block chain")
+)
+
+const lastBlock = 0xffff
 
 type blockMap struct {
 	Checksum           [checksums][hash.Size]byte
@@ -59,12 +75,50 @@ func (m *blockMap) isValid() error {
 	c1, c2 := m.Checksum[checksumNormal][:], m.Checksum[checksumInverted][:]
 
 	if !bytes.Equal(c1, normal) || !bytes.Equal(c2, inverted) {
-		return errBadBlockMapChecksum
+		return ErrBadBlockMapChecksum
 	}
 
 	return nil
 }
 
+// chain follows the chain of blocks starting at first, stopping at the first
+// block that lies outside of a card with the given number of blocks or that
+// has already been visited. The blocks visited up to that point are always
+// returned.
+func (m *blockMap) chain(first uint16, blocks int) ([]uint16, error) {
+	chain := []uint16{}
+	seen := make(map[uint16]struct{})
+
+	for b := first; b != lastBlock; b = m.Blocks[b-reservedBlocks] {
+		if b < reservedBlocks || int(b) >= blocks {
+			return chain, ErrBlockOutOfRange
+		}
+
+		if _, ok := seen[b]; ok {
+			return chain, ErrBlockChainLoop
+		}
+
+		seen[b] = struct{}{}
+		chain = append(chain, b)
+	}
+
+	return chain, nil
+}
+
+// freeBlocks counts the unallocated blocks on a card with the given number of
+// blocks.
+func (m *blockMap) freeBlocks(blocks int) uint16 {
+	var free uint16
+
+	for _, b := range m.Blocks[:blocks-reservedBlocks] {
+		if b == 0 {
+			free++
+		}
+	}
+
+	return free
+}
+
 func newBlockMap(updateCounter, freeBlocks uint16) blockMap {
 	return blockMap{
 		UpdateCounter:      updateCounter,
@@ -0,0 +1,85 @@
+package gc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrNoCopy is returned when copying a file with the PermissionNoCopy
+	// flag set.
+	ErrNoCopy = errors.New("file may not be copied")
+	// ErrNoMove is returned when moving a file with the PermissionNoMove
+	// flag set.
+	ErrNoMove = errors.New("file may not be moved")
+)
+
+// CopyFlag controls how files are copied between memory cards.
+type CopyFlag int
+
+// Copy flags.
+const (
+	// CopyMove treats the copy as the first half of moving the files,
+	// the caller being responsible for removing the originals. Files with
+	// PermissionNoMove set are skipped instead of those with
+	// PermissionNoCopy set, and the copy counter is left unchanged.
+	CopyMove CopyFlag = 1 << iota
+	// CopyForce copies files regardless of their permissions.
+	CopyForce
+)
+
+// A SkippedFile is a file that could not be copied.
+type SkippedFile struct {
+	*File
+
+	// Err is the reason the file was skipped.
+	Err error
+}
+
+// copyFile copies f on to the memory card in the same way as the IPL. The
+// lock must be held.
+func (c *core) copyFile(f *File, flags CopyFlag) error {
+	switch {
+	case flags&CopyForce != 0:
+	case flags&CopyMove != 0 && f.Permissions&PermissionNoMove != 0:
+		return ErrNoMove
+	case flags&CopyMove == 0 && f.Permissions&PermissionNoCopy != 0:
+		return ErrNoCopy
+	}
+
+	fr, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	fw := c.create(nil)
+
+	if _, err := io.Copy(fw, fr); err != nil {
+		delete(c.fw, fw)
+
+		return fmt.Errorf("unable to copy: %w", err)
+	}
+
+	// The IPL increments the copy counter of the new file on each copy
+	if flags&CopyMove == 0 {
+		fw.buf.Bytes()[entryCopyCounterOffset]++
+	}
+
+	return fw.close()
+}
+
+// copyFiles copies each of files on to the memory card, returning those that
+// were skipped. The lock must be held.
+func (c *core) copyFiles(files []*File, flags CopyFlag) []*SkippedFile {
+	var skipped []*SkippedFile
+
+	for _, f := range files {
+		if err := c.copyFile(f, flags); err != nil {
+			skipped = append(skipped, &SkippedFile{f, err})
+		}
+	}
+
+	return skipped
+}
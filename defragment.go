@@ -0,0 +1,145 @@
+package gc
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Order describes how files are arranged on a defragmented memory card.
+type Order int
+
+// Orders that can be used when defragmenting.
+const (
+	// OrderSlot keeps the files in the order of their directory slots.
+	OrderSlot Order = iota
+	// OrderGameCode sorts the files by game and maker code, files for
+	// the same game are kept in the order of their directory slots.
+	OrderGameCode
+)
+
+// chains returns the chain of blocks for the file in each of slots in the
+// active directory. Every chain must be intact, match the length of its file
+// and not share any blocks with another.
+func (mc *memoryCard) chains(slots []int) ([][]uint16, error) {
+	d, m := mc.activeDirectory(), mc.activeBlockMap()
+
+	chains := make([][]uint16, len(slots))
+	owners := make(map[uint16]int)
+
+	for i, slot := range slots {
+		e := &mc.directory[d].Entries[slot]
+
+		chain, err := mc.blockMap[m].chain(e.FirstBlock, mc.header.blocks())
+		if err != nil {
+			return nil, mc.chainError(d, m, slot, chain, err)
+		}
+
+		if len(chain) == 0 || len(chain) != int(e.FileLength) {
+			return nil, newCorruptionError(StructureDirectory, d, slot, entryOffset(slot, entryFileLengthOffset),
+				fmt.Errorf("%w: %d blocks, expected %d", ErrFileLengthMismatch, len(chain), e.FileLength))
+		}
+
+		for j, b := range chain {
+			if owner, ok := owners[b]; ok {
+				return nil, mc.chainError(d, m, slot, chain[:j],
+					fmt.Errorf("%w: block %d also used by entry %d", ErrBlockCrossLinked, b, owner))
+			}
+
+			owners[b] = slot
+		}
+
+		chains[i] = chain
+	}
+
+	return chains, nil
+}
+
+// defragment rearranges the memory card so that the files occupy the lowest
+// directory slots in the given order and each file is stored in a contiguous
+// run of blocks immediately after the previous one, leaving all of the free
+// blocks at the end of the card where they are erased.
+func (mc *memoryCard) defragment(order Order) error {
+	d, m := mc.directory[mc.activeDirectory()], mc.blockMap[mc.activeBlockMap()]
+
+	slots := make([]int, 0, maxEntries)
+
+	for i := range d.Entries {
+		if !d.Entries[i].isEmpty() {
+			slots = append(slots, i)
+		}
+	}
+
+	if order == OrderGameCode {
+		sort.SliceStable(slots, func(i, j int) bool {
+			a, b := &d.Entries[slots[i]], &d.Entries[slots[j]]
+			if c := bytes.Compare(a.GameCode[:], b.GameCode[:]); c != 0 {
+				return c < 0
+			}
+
+			return bytes.Compare(a.MakerCode[:], b.MakerCode[:]) < 0
+		})
+	}
+
+	chains, err := mc.chains(slots)
+	if err != nil {
+		return err
+	}
+
+	nd, nm := d, m
+	for i := range nd.Entries {
+		nd.Entries[i] = newEntry()
+	}
+
+	nm.Blocks = [len(m.Blocks)]uint16{}
+
+	blocks := make([][blockSize]byte, len(mc.blocks))
+	next := uint16(reservedBlocks)
+
+	for i, slot := range slots {
+		nd.Entries[i] = d.Entries[slot]
+		nd.Entries[i].FirstBlock = next
+
+		chain := chains[i]
+		for j, b := range chain {
+			blocks[next-reservedBlocks] = mc.blocks[b-reservedBlocks]
+
+			if j+1 < len(chain) {
+				nm.Blocks[next-reservedBlocks] = next + 1
+			} else {
+				nm.Blocks[next-reservedBlocks] = lastBlock
+			}
+
+			next++
+		}
+	}
+
+	for i := int(next) - reservedBlocks; i < len(blocks); i++ {
+		erase(&blocks[i])
+	}
+
+	for i := range blocks {
+		if blocks[i] != mc.blocks[i] {
+			mc.touch(reservedBlocks + i)
+		}
+	}
+
+	nm.FreeBlocks = nm.freeBlocks(mc.header.blocks())
+	nm.LastAllocatedBlock = next - 1
+
+	mc.blocks = blocks
+
+	// The previous copies describe blocks that have since moved so commit
+	// everything twice, leaving no stale fallback behind
+	for i := 0; i < copies; i++ {
+		if err := mc.commitBlockMap(nm); err != nil {
+			return err
+		}
+
+		if err := mc.commitDirectory(nd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
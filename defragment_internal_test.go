@@ -0,0 +1,109 @@
+package gc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// defragmentCard returns a 59 block card holding a 50 block file and a 1 block
+// file, after applying modify to the active directory.
+func defragmentCard(t *testing.T, modify func(*directory)) []byte {
+	t.Helper()
+
+	mc, err := newMemoryCard([12]byte{}, 0, MemoryCard59, EncodingANSI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, h := range []SaveHeader{
+		{GameCode: "GTST", MakerCode: "01", Name: "a", Size: 50 * blockSize, ImageDataOffset: noOffset, CommentAddress: noOffset},
+		{GameCode: "GTST", MakerCode: "01", Name: "b", Size: blockSize, ImageDataOffset: noOffset, CommentAddress: noOffset},
+	} {
+		h := h
+
+		e, err := h.entry(EncodingANSI)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mc.addFile(i, e, bytes.NewReader(make([]byte, h.Size)), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := &mc.directory[mc.activeDirectory()]
+	modify(d)
+
+	if err := d.checksum(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := mc.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestDefragmentBroken(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name   string
+		modify func(*directory)
+		err    error
+	}{
+		{
+			name: "cross-linked",
+			modify: func(d *directory) {
+				d.Entries[1].FirstBlock, d.Entries[1].FileLength = d.Entries[0].FirstBlock, d.Entries[0].FileLength
+			},
+			err: ErrBlockCrossLinked,
+		},
+		{
+			name: "empty chain",
+			modify: func(d *directory) {
+				d.Entries[0].FirstBlock = lastBlock
+			},
+			err: ErrFileLengthMismatch,
+		},
+		{
+			name: "length mismatch",
+			modify: func(d *directory) {
+				d.Entries[1].FileLength = 3
+			},
+			err: ErrFileLengthMismatch,
+		},
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.name, func(t *testing.T) {
+			t.Parallel()
+
+			b := defragmentCard(t, table.modify)
+
+			e, err := NewEditor(bytes.NewReader(b), int64(len(b)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = e.Defragment(OrderSlot)
+			assert.ErrorIs(t, err, table.err)
+
+			var target *CorruptionError
+			assert.ErrorAs(t, err, &target)
+
+			// Nothing was changed
+			buf := new(bytes.Buffer)
+			if err := e.Save(buf); err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, b, buf.Bytes())
+		})
+	}
+}
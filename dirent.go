@@ -11,9 +11,12 @@ import (
 	"github.com/bodgit/plumbing"
 )
 
-var errBadDirectoryChecksum = errors.New("bad directory checksum")
+// ErrBadDirectoryChecksum is returned when the checksum of a directory
+// doesn't match its contents.
+var ErrBadDirectoryChecksum = errors.New("bad directory checksum")
 
 const (
+	filenameSize         = 32
 	entryReserved1Offset = 0x06
 	entryReserved2Offset = 0x3a
 	entryReserved2Size   = 0x02
@@ -26,13 +29,13 @@ type entry struct {
 	GameCode        [4]byte
 	MakerCode       [2]byte
 	_               byte
-	BannerFormat    byte
-	Filename        [32]byte
+	BannerFormat    BannerFormat
+	Filename        [filenameSize]byte
 	LastModified    uint32
 	ImageDataOffset uint32
-	IconGfxFormat   uint16
-	AnimationSpeed  uint16
-	Permissions     byte
+	IconGfxFormat   IconFormat
+	AnimationSpeed  AnimationSpeed
+	Permissions     Permission
 	CopyCounter     byte
 	FirstBlock      uint16
 	FileLength      uint16
@@ -56,10 +59,172 @@ func (e *entry) filename() string {
 	return string(bytes.TrimRight(e.Filename[:], "\x00"))
 }
 
+// name returns the filename decoded from the memory card encoding.
+func (e *entry) name(encoding uint16) string {
+	return DecodeString(encoding, e.Filename[:])
+}
+
 func (e *entry) lastModified() time.Time {
 	return epoch.Add(time.Second * time.Duration(e.LastModified))
 }
 
+// BannerFormat describes the format of the banner image in the lower two
+// bits, along with how the icon is animated.
+type BannerFormat uint8
+
+// Banner formats and flags.
+const (
+	BannerNone   BannerFormat = 0x00
+	BannerCI8    BannerFormat = 0x01
+	BannerRGB5A3 BannerFormat = 0x02
+
+	// BannerPingPong indicates the icon animation plays forwards and
+	// then backwards rather than looping.
+	BannerPingPong BannerFormat = 0x04
+)
+
+// Format returns the format of the banner image, without any flags.
+func (f BannerFormat) Format() BannerFormat {
+	return f & formatMask
+}
+
+// PingPong returns true if the icon animation plays forwards and then
+// backwards rather than looping.
+func (f BannerFormat) PingPong() bool {
+	return f&BannerPingPong != 0
+}
+
+// IconFormat describes the format of each of up to eight icon frames, using
+// two bits per frame.
+type IconFormat uint16
+
+// Icon frame formats.
+const (
+	IconNone IconFormat = iota
+	IconCI8Shared
+	IconRGB5A3
+	IconCI8
+)
+
+// Frame returns the format of icon frame i.
+func (f IconFormat) Frame(i int) IconFormat {
+	return (f >> (2 * i)) & formatMask
+}
+
+// AnimationSpeed describes how long each of up to eight icon frames is
+// displayed for, using two bits per frame.
+type AnimationSpeed uint16
+
+// Icon frame speeds, each is a multiple of four video frames. A frame with a
+// speed of SpeedNone marks the end of the animation.
+const (
+	SpeedNone AnimationSpeed = iota
+	Speed4
+	Speed8
+	Speed12
+)
+
+// Frame returns the speed of icon frame i.
+func (s AnimationSpeed) Frame(i int) AnimationSpeed {
+	return (s >> (2 * i)) & formatMask
+}
+
+// Permission is the set of permission flags for a file.
+type Permission uint8
+
+// Permission flags.
+const (
+	PermissionPublic Permission = 1 << (iota + 2)
+	PermissionNoCopy
+	PermissionNoMove
+)
+
+// Banner and icon dimensions.
+const (
+	bannerWidth  = 96
+	bannerHeight = 32
+	iconWidth    = 32
+	iconHeight   = 32
+	maxIcons     = 8
+	paletteSize  = 256 * 2
+	formatMask   = 0x03
+)
+
+// size returns the number of bytes used by a banner in format f.
+func (f BannerFormat) size() int {
+	switch f.Format() {
+	case BannerCI8:
+		return bannerWidth*bannerHeight + paletteSize
+	case BannerRGB5A3:
+		return bannerWidth * bannerHeight * 2
+	default:
+		return 0
+	}
+}
+
+// size returns the number of bytes used by an icon frame in format f, not
+// including any shared palette.
+func (f IconFormat) size() int {
+	switch f {
+	case IconCI8Shared:
+		return iconWidth * iconHeight
+	case IconRGB5A3:
+		return iconWidth * iconHeight * 2
+	case IconCI8:
+		return iconWidth*iconHeight + paletteSize
+	default:
+		return 0
+	}
+}
+
+// icons returns the number of icon frames, the animation ends at the first
+// frame with a speed of SpeedNone.
+func (e *entry) icons() int {
+	for i := 0; i < maxIcons; i++ {
+		if e.AnimationSpeed.Frame(i) == SpeedNone {
+			return i
+		}
+	}
+
+	return maxIcons
+}
+
+// imageDataSize returns the number of bytes used by the banner and icons
+// starting at ImageDataOffset. Space is used by every icon frame with a
+// format, even those after the end of the animation, and any shared palette
+// follows all of them.
+func (e *entry) imageDataSize() int {
+	size := e.BannerFormat.size()
+	shared := false
+
+	for i := 0; i < maxIcons; i++ {
+		f := e.IconGfxFormat.Frame(i)
+		size += f.size()
+		shared = shared || f == IconCI8Shared
+	}
+
+	if shared {
+		size += paletteSize
+	}
+
+	return size
+}
+
+// imageDataInRange returns true if the banner and icons lie within the file
+// data, or there aren't any.
+func (e *entry) imageDataInRange() bool {
+	size := e.imageDataSize()
+
+	return size == 0 || e.ImageDataOffset == noOffset ||
+		int64(e.ImageDataOffset)+int64(size) <= int64(e.FileLength)*blockSize
+}
+
+// commentInRange returns true if the comments lie within the file data, or
+// there aren't any.
+func (e *entry) commentInRange() bool {
+	return e.CommentAddress == noOffset || int64(e.CommentAddress)+commentSize <= int64(e.FileLength)*blockSize
+}
+
 func (e *entry) MarshalBinary() ([]byte, error) {
 	buf := new(bytes.Buffer)
 	buf.Grow(binary.Size(e))
@@ -149,7 +314,7 @@ func (d *directory) isValid() error {
 	c1, c2 := d.Checksum[checksumNormal][:], d.Checksum[checksumInverted][:]
 
 	if !bytes.Equal(c1, normal) || !bytes.Equal(c2, inverted) {
-		return errBadDirectoryChecksum
+		return ErrBadDirectoryChecksum
 	}
 
 	return nil
@@ -0,0 +1,189 @@
+package gc
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// An Editor is used for modifying an existing memory card image. Anything not
+// affected by an edit, such as the header and the slots used by other files,
+// is preserved.
+//
+// Files are named as in the fs.FS presented by a Reader, escaped with
+// EscapeName and optionally prefixed by the game and maker codes as a
+// directory, as with the GroupByGame option.
+type Editor struct {
+	core
+}
+
+// NewEditor returns an Editor for the memory card image read from r, which is
+// assumed to have the given size in bytes. The whole image is read into
+// memory so r is not used again.
+func NewEditor(r io.ReaderAt, size int64) (*Editor, error) {
+	mc := new(memoryCard)
+
+	if err := mc.unmarshalBinary(io.NewSectionReader(r, 0, size)); err != nil {
+		return nil, err
+	}
+
+	if err := mc.isValid(); err != nil {
+		return nil, err
+	}
+
+	return &Editor{newCore(mc)}, nil
+}
+
+// Create returns an io.WriteCloser for writing a new file on the memory card,
+// which is stored in the first unused directory slot. As with Writer.Create,
+// the file should be in GCI format.
+func (e *Editor) Create() (io.WriteCloser, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.mc.count() == maxEntries || e.mc.blockMap[e.mc.activeBlockMap()].FreeBlocks == 0 {
+		return nil, ErrNoFreeSpace
+	}
+
+	return e.create(nil), nil
+}
+
+// CreateHeader returns an io.WriteCloser for writing a new file on the memory
+// card described by h, which is stored in the first unused directory slot. As
+// with Writer.CreateHeader, only the file data should be written.
+func (e *Editor) CreateHeader(h *SaveHeader) (io.WriteCloser, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	fw, err := e.createHeader(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return fw, nil
+}
+
+// Copy copies each of files on to the memory card, each is stored in the first
+// unused directory slot. As with Writer.Copy, the files that could not be
+// copied are returned along with the reason why.
+func (e *Editor) Copy(files []*File, flags CopyFlag) []*SkippedFile {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.copyFiles(files, flags)
+}
+
+// Replace returns an io.WriteCloser for writing a new version of the named
+// file, in GCI format. When it is closed the new file is stored in the same
+// directory slot and the existing file is removed. The existing file isn't
+// removed until the new one has been stored, so there must be enough free
+// blocks for the new file.
+func (e *Editor) Replace(name string) (io.WriteCloser, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	slot, err := e.mc.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "replace", Path: name, Err: err}
+	}
+
+	old := e.mc.directory[e.mc.activeDirectory()].Entries[slot]
+
+	return e.create(&old), nil
+}
+
+// Remove removes the named file from the memory card.
+func (e *Editor) Remove(name string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	slot, err := e.mc.lookup(name)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+
+	return e.mc.removeFile(slot)
+}
+
+// Rename changes the filename of the named file to newname, which is escaped
+// as with EscapeName. The game and maker codes are unchanged so newname
+// should be just a filename.
+func (e *Editor) Rename(oldname, newname string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	slot, err := e.mc.lookup(oldname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+
+	b, err := UnescapeName(e.mc.header.Encoding, newname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+
+	x := e.mc.directory[e.mc.activeDirectory()].Entries[slot]
+	x.Filename = [filenameSize]byte{}
+	copy(x.Filename[:], b)
+
+	switch {
+	case x.filename() == "":
+		err = fmt.Errorf("%w: empty filename", ErrInvalidName)
+	case e.mc.conflicts(&x, slot):
+		err = ErrDuplicateName
+	}
+
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+
+	d := e.mc.directory[e.mc.activeDirectory()]
+	d.Entries[slot] = x
+
+	return e.mc.commitDirectory(d)
+}
+
+// Defragment rearranges the memory card so that each file is stored in a
+// contiguous run of blocks with all of the free space at the end of the card,
+// and the files occupy the lowest directory slots, arranged according to
+// order. Any in-flight open memory card files are closed first.
+//
+// Free blocks are erased and both copies of the directory and block
+// allocation map are rewritten, so any deleted files are no longer reported
+// by Reader.Deleted.
+func (e *Editor) Defragment(order Order) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.closeAll(); err != nil {
+		return err
+	}
+
+	return e.mc.defragment(order)
+}
+
+// Save writes out the memory card to w. Any in-flight open memory card files
+// are closed first. The Editor can continue to be used afterwards.
+func (e *Editor) Save(w io.Writer) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.save(w)
+}
+
+// SaveAt writes out just the blocks of the memory card that have changed since
+// the Editor was created, or since the last call to SaveAt, to w. Typically w
+// is the same file the memory card image was read from. Any in-flight open
+// memory card files are closed first. The Editor can continue to be used
+// afterwards.
+func (e *Editor) SaveAt(w io.WriterAt) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.closeAll(); err != nil {
+		return err
+	}
+
+	return e.mc.writeAt(w)
+}
@@ -0,0 +1,478 @@
+package gc_test
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/bodgit/gc"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, w io.WriteCloser, b []byte) {
+	t.Helper()
+
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//nolint:funlen
+func TestEditor(t *testing.T) {
+	t.Parallel()
+
+	image, err := os.ReadFile(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := gc.NewReader(bytes.NewReader(image))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zelda, err := r.ReadFile("gczelda")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metroid, err := r.ReadFile("MetroidPrime")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := gc.NewEditor(bytes.NewReader(image), int64(len(image)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Free up some space
+	assert.Nil(t, e.Remove("Star Fox Adventures"))
+	assert.Nil(t, e.Remove("G4SP01/gc4sword"))
+	assert.Nil(t, e.Rename("gczelda", "gczelda_old"))
+
+	// The new file takes the first free slot
+	w, err := e.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, w, zelda)
+
+	w, err = e.Replace("MetroidPrime")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, w, metroid)
+
+	assert.ErrorIs(t, e.Remove("missing"), fs.ErrNotExist)
+	assert.ErrorIs(t, e.Rename("gczelda_old", "gczelda"), gc.ErrDuplicateName)
+	assert.ErrorIs(t, e.Rename("gczelda_old", "%00"), gc.ErrInvalidName)
+	assert.ErrorIs(t, e.Rename("gczelda_old", "GZLE01/gczelda"), gc.ErrInvalidName)
+
+	// Removing a file that's being replaced fails the replacement
+	w, err = e.Replace("MetroidPrime2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, e.Remove("MetroidPrime2"))
+
+	if _, err := w.Write(metroid); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.ErrorIs(t, w.Close(), fs.ErrNotExist)
+
+	buf := new(bytes.Buffer)
+	if err := e.Save(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	nr, err := gc.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, nr.Verify().OK())
+	assert.Equal(t, r.FlashID, nr.FlashID)
+	assert.Equal(t, r.FormatTime, nr.FormatTime)
+
+	tables := []struct {
+		slot int
+		name string
+		data []byte
+	}{
+		{0, "gczelda", zelda},
+		{1, "MetroidPrime", metroid},
+		{2, "gczelda_old", zelda},
+		{3, "fzc.dat", nil},
+		{4, "Prince of Persia", nil},
+	}
+
+	if !assert.Len(t, nr.File, len(tables)) {
+		return
+	}
+
+	for i, table := range tables {
+		f := nr.File[i]
+
+		assert.Equal(t, table.slot, f.Slot)
+		assert.Equal(t, table.name, f.Name)
+
+		if table.data == nil {
+			continue
+		}
+
+		fr, err := f.OpenData()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := io.ReadAll(fr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, table.data[0x40:], b)
+	}
+
+	// New blocks are allocated after the last allocated block
+	assert.Equal(t, uint16(65), nr.File[0].FirstBlock)
+}
+
+//nolint:funlen
+func TestDefragment(t *testing.T) {
+	t.Parallel()
+
+	image, err := os.ReadFile(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tables := []struct {
+		name  string
+		order gc.Order
+	}{
+		{"slot", gc.OrderSlot},
+		{"game code", gc.OrderGameCode},
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.name, func(t *testing.T) {
+			t.Parallel()
+
+			e, err := gc.NewEditor(bytes.NewReader(image), int64(len(image)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := gc.NewReader(bytes.NewReader(image))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			zelda, err := r.ReadFile("gczelda")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Leave a hole in the middle of the card and an empty slot
+			assert.Nil(t, e.Remove("Star Fox Adventures"))
+			assert.Nil(t, e.Remove("fzc.dat"))
+			assert.Nil(t, e.Rename("gczelda", "gczelda_old"))
+
+			w, err := e.Create()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			writeFile(t, w, zelda)
+
+			buf := new(bytes.Buffer)
+			if err := e.Save(buf); err != nil {
+				t.Fatal(err)
+			}
+
+			before, err := gc.NewReader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			files := append([]*gc.File{}, before.File...)
+			if table.order == gc.OrderGameCode {
+				sort.SliceStable(files, func(i, j int) bool {
+					return files[i].GameCode+files[i].MakerCode < files[j].GameCode+files[j].MakerCode
+				})
+			}
+
+			assert.Nil(t, e.Defragment(table.order))
+
+			buf.Reset()
+			if err := e.Save(buf); err != nil {
+				t.Fatal(err)
+			}
+
+			nr, err := gc.NewReader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.True(t, nr.Verify().OK())
+			assert.Empty(t, nr.Deleted())
+
+			if !assert.Len(t, nr.File, len(files)) {
+				return
+			}
+
+			next := uint16(5)
+
+			for i, f := range nr.File {
+				assert.Equal(t, i, f.Slot)
+				assert.Equal(t, files[i].Name, f.Name)
+				assert.Equal(t, next, f.FirstBlock)
+
+				next += f.FileLength
+
+				want, err := before.ReadFile(files[i].Name)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				b, err := nr.ReadFile(f.Name)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				assert.Equal(t, want[:0x36], b[:0x36])
+				assert.Equal(t, want[0x40:], b[0x40:])
+			}
+
+			// New blocks are allocated straight after the defragmented files
+			w, err = e.Create()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			zelda[0x08] = 'G'
+			writeFile(t, w, zelda)
+
+			buf.Reset()
+			if err := e.Save(buf); err != nil {
+				t.Fatal(err)
+			}
+
+			nr, err = gc.NewReader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if assert.Len(t, nr.File, len(files)+1) {
+				assert.Equal(t, next, nr.File[len(files)].FirstBlock)
+			}
+		})
+	}
+}
+
+type offsetWriterAt struct {
+	b       []byte
+	offsets []int64
+}
+
+func (w *offsetWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	w.offsets = append(w.offsets, off)
+
+	return copy(w.b[off:], p), nil
+}
+
+func TestSaveAt(t *testing.T) {
+	t.Parallel()
+
+	image, err := os.ReadFile(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := gc.NewReader(bytes.NewReader(image))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zelda, err := r.ReadFile("gczelda")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := gc.NewEditor(bytes.NewReader(image), int64(len(image)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, e.Remove("gczelda"))
+
+	w, err := e.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, w, zelda)
+
+	buf := new(bytes.Buffer)
+	if err := e.Save(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	wa := &offsetWriterAt{b: append([]byte{}, image...)}
+
+	if err := e.SaveAt(wa); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, buf.Bytes(), wa.b)
+
+	// Only the new data blocks are written, followed by the directory and
+	// block allocation map copies in the order they were committed: the
+	// directory then block allocation map for the removal, and the other
+	// way around for the new file
+	want := []int64{}
+	for b := int64(65); b <= 76; b++ {
+		want = append(want, b*0x2000)
+	}
+
+	want = append(want, 1*0x2000, 4*0x2000, 3*0x2000, 2*0x2000)
+
+	assert.Equal(t, want, wa.offsets)
+
+	// Nothing further to write
+	wa.offsets = nil
+
+	if err := e.SaveAt(wa); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Empty(t, wa.offsets)
+}
+
+//nolint:funlen
+func TestReplaceFull(t *testing.T) {
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+
+	w, err := gc.NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fill the card with three files
+	for _, h := range []gc.SaveHeader{
+		{GameCode: "GTST", MakerCode: "01", Name: "a", Size: 0x2000, ImageDataOffset: 0xffffffff, CommentAddress: 0xffffffff},
+		{GameCode: "GTST", MakerCode: "01", Name: "b", Size: 29 * 0x2000, ImageDataOffset: 0xffffffff, CommentAddress: 0xffffffff},
+		{GameCode: "GTST", MakerCode: "01", Name: "c", Size: 29 * 0x2000, ImageDataOffset: 0xffffffff, CommentAddress: 0xffffffff},
+	} {
+		h := h
+
+		fw, err := w.CreateHeader(&h)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		writeFile(t, fw, bytes.Repeat([]byte(h.Name), int(h.Size)))
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := gc.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := r.ReadFile("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := gc.NewEditor(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed replacement leaves the original file intact
+	fw, err := e.Replace("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fw.Write(b[:len(b)-1]); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.ErrorIs(t, fw.Close(), gc.ErrInvalidLength)
+
+	// Replacing a file on a full card doesn't reuse its blocks
+	fw, err = e.Replace("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copy(b[0x40:], "new")
+
+	if _, err := fw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.ErrorIs(t, fw.Close(), gc.ErrNoFreeSpace)
+
+	nb := new(bytes.Buffer)
+	if err := e.Save(nb); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, buf.Bytes(), nb.Bytes())
+
+	// Once there's room for both copies the replacement succeeds
+	if err := e.Remove("c"); err != nil {
+		t.Fatal(err)
+	}
+
+	fw, err = e.Replace("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, fw, b)
+
+	nb.Reset()
+	if err := e.Save(nb); err != nil {
+		t.Fatal(err)
+	}
+
+	nr, err := gc.NewReader(bytes.NewReader(nb.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, nr.Verify().OK())
+
+	if assert.Len(t, nr.File, 2) {
+		assert.Equal(t, "a", nr.File[0].Name)
+		assert.Equal(t, "b", nr.File[1].Name)
+	}
+
+	got, err := nr.ReadFile("b")
+	if assert.NoError(t, err) {
+		assert.Equal(t, b[0x40:], got[0x40:])
+	}
+}
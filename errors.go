@@ -0,0 +1,136 @@
+package gc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Structure identifies one of the metadata structures stored in the reserved
+// blocks at the start of a memory card.
+type Structure int
+
+// Memory card metadata structures.
+const (
+	StructureHeader Structure = iota
+	StructureDirectory
+	StructureBlockMap
+)
+
+func (s Structure) String() string {
+	switch s {
+	case StructureHeader:
+		return "header"
+	case StructureDirectory:
+		return "directory"
+	case StructureBlockMap:
+		return "block map"
+	default:
+		return fmt.Sprintf("Structure(%d)", int(s))
+	}
+}
+
+// offset returns the offset of copy c of the structure within the image.
+func (s Structure) offset(c int) int64 {
+	switch s {
+	case StructureDirectory:
+		return int64(1+c) * blockSize
+	case StructureBlockMap:
+		return int64(3+c) * blockSize
+	default:
+		return 0
+	}
+}
+
+// block returns the number of the block holding copy c of the structure.
+func (s Structure) block(c int) int {
+	return int(s.offset(c) / blockSize)
+}
+
+// Copy identifies which of the two copies of the directory or block
+// allocation map is meant.
+type Copy int
+
+// Directory and block allocation map copies.
+const (
+	CopyMaster Copy = master
+	CopyBackup Copy = backup
+)
+
+func (c Copy) String() string {
+	return copyName(int(c))
+}
+
+// Offsets of fields within each structure.
+const (
+	headerCardSizeOffset         = 0x0022
+	headerEncodingOffset         = 0x0024
+	headerChecksumOffset         = 0x01fc
+	entryImageDataOffset         = 0x2c
+	entryCopyCounterOffset       = 0x35
+	entryFirstBlockOffset        = 0x36
+	entryFileLengthOffset        = 0x38
+	entryCommentAddressOffset    = 0x3c
+	entrySize                    = 0x40
+	directoryUpdateCounterOffset = 0x1ffa
+	directoryChecksumOffset      = 0x1ffc
+	blockMapChecksumOffset       = 0x0000
+	blockMapUpdateCounterOffset  = 0x0004
+	blockMapFreeBlocksOffset     = 0x0006
+	blockMapLastAllocatedOffset  = 0x0008
+	blockMapBlocksOffset         = 0x000a
+)
+
+// A CorruptionError records where in a memory card image a problem was found.
+type CorruptionError struct {
+	// Structure is the structure containing the problem.
+	Structure Structure
+	// Copy is the copy of the directory or block allocation map, it is
+	// not meaningful for the header.
+	Copy Copy
+	// Offset is the byte offset within the image of the field containing
+	// the problem.
+	Offset int64
+	// Entry is the index of the directory entry for the affected file, or
+	// -1 if the problem does not concern a single file.
+	Entry int
+	// Err is the underlying problem.
+	Err error
+}
+
+func newCorruptionError(s Structure, c, entry, offset int, err error) *CorruptionError {
+	return &CorruptionError{
+		Structure: s,
+		Copy:      Copy(c),
+		Offset:    s.offset(c) + int64(offset),
+		Entry:     entry,
+		Err:       err,
+	}
+}
+
+func entryOffset(entry, offset int) int {
+	return entry*entrySize + offset
+}
+
+func linkOffset(block uint16) int {
+	return blockMapBlocksOffset + 2*int(block-reservedBlocks) //nolint:gomnd
+}
+
+func (e *CorruptionError) Error() string {
+	b := new(strings.Builder)
+
+	if e.Structure != StructureHeader {
+		b.WriteString(e.Copy.String() + " ")
+	}
+
+	b.WriteString(e.Structure.String())
+
+	if e.Entry >= 0 {
+		fmt.Fprintf(b, " entry %d", e.Entry)
+	}
+
+	fmt.Fprintf(b, " at offset %#x: %v", e.Offset, e.Err)
+
+	return b.String()
+}
+
+func (e *CorruptionError) Unwrap() error { return e.Err }
@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 
 	"github.com/bodgit/gc/internal/hash"
 )
 
-var errBadHeaderChecksum = errors.New("bad header checksum")
+// ErrBadHeaderChecksum is returned when the checksum of the header doesn't
+// match its contents.
+var ErrBadHeaderChecksum = errors.New("bad header checksum")
 
 const (
 	headerReserved1Size   = 0x0004
@@ -18,12 +21,45 @@ const (
 	headerReserved3Size   = 0x1e00
 )
 
+// Language is the language the IPL was set to when a memory card was
+// formatted.
+type Language uint32
+
+// Supported languages.
+const (
+	LanguageEnglish Language = iota
+	LanguageGerman
+	LanguageFrench
+	LanguageSpanish
+	LanguageItalian
+	LanguageDutch
+)
+
+func (l Language) String() string {
+	switch l {
+	case LanguageEnglish:
+		return "English"
+	case LanguageGerman:
+		return "German"
+	case LanguageFrench:
+		return "French"
+	case LanguageSpanish:
+		return "Spanish"
+	case LanguageItalian:
+		return "Italian"
+	case LanguageDutch:
+		return "Dutch"
+	default:
+		return fmt.Sprintf("Language(%d)", uint32(l))
+	}
+}
+
 //nolint:maligned
 type header struct {
 	Serial        [12]byte
 	FormatTime    uint64 // Ticks since GameCube epoch
 	CounterBias   uint32
-	Lang          uint32
+	Lang          Language
 	Unknown       [headerReserved1Size]byte // Seems to be either 0 or 1 as a uint32
 	DeviceID      uint16
 	CardSize      uint16
@@ -105,7 +141,7 @@ func (h *header) isValid() error {
 	c1, c2 := h.Checksum[checksumNormal][:], h.Checksum[checksumInverted][:]
 
 	if !bytes.Equal(c1, normal) || !bytes.Equal(c2, inverted) {
-		return errBadHeaderChecksum
+		return ErrBadHeaderChecksum
 	}
 
 	return nil
@@ -0,0 +1,203 @@
+package gc
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"time"
+
+	"github.com/bodgit/gc/internal/texture"
+)
+
+const (
+	// Each icon speed step is four video frames at 60 Hz.
+	iconSpeedFrames = 4
+	videoFrameRate  = 60
+
+	gifDelayUnit = 10 * time.Millisecond
+	gifColors    = 256
+)
+
+// An Icon is the animated icon for a file.
+type Icon struct {
+	// Image holds each frame of the icon in the order they are stored. A
+	// CI8 frame is an *image.Paletted and an RGB5A3 frame is an
+	// *image.NRGBA.
+	Image []image.Image
+	// Delay holds how long each frame is displayed for.
+	Delay []time.Duration
+	// PingPong is true if the animation plays forwards and then backwards
+	// rather than looping.
+	PingPong bool
+}
+
+func decodeIcon(format IconFormat, b, shared []byte) (image.Image, error) {
+	var (
+		p   color.Palette
+		err error
+	)
+
+	switch format {
+	case IconRGB5A3:
+		return texture.DecodeRGB5A3(b, iconWidth, iconHeight) //nolint:wrapcheck
+	case IconCI8Shared:
+		p, err = texture.DecodePalette(shared)
+	case IconCI8:
+		p, err = texture.DecodePalette(b[iconWidth*iconHeight:])
+	}
+
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return texture.DecodeCI8(b, p, iconWidth, iconHeight) //nolint:wrapcheck
+}
+
+// Icon returns the animated icon for the file, or nil if the file doesn't
+// have one. The animation ends at the first frame with a speed of SpeedNone,
+// a frame with a format of IconNone repeats the previous frame.
+func (f *File) Icon() (*Icon, error) {
+	n := f.e.icons()
+	if n == 0 || f.e.ImageDataOffset == noOffset {
+		return nil, nil //nolint:nilnil
+	}
+
+	b := make([]byte, f.e.imageDataSize())
+
+	if err := f.readAt(b, f.e.ImageDataOffset, entryImageDataOffset, ErrImageDataOffsetOutOfRange); err != nil {
+		return nil, err
+	}
+
+	b = b[f.e.BannerFormat.size():]
+
+	// Frames are laid out by format alone, including any after the end
+	// of the animation, and the shared palette, if any, follows them all
+	offsets := make([]int, maxIcons)
+	shared := 0
+
+	for i := range offsets {
+		offsets[i] = shared
+		shared += f.e.IconGfxFormat.Frame(i).size()
+	}
+
+	icon := &Icon{
+		Image:    make([]image.Image, n),
+		Delay:    make([]time.Duration, n),
+		PingPong: f.e.BannerFormat.PingPong(),
+	}
+
+	var prev image.Image = image.NewNRGBA(image.Rect(0, 0, iconWidth, iconHeight))
+
+	for i := 0; i < n; i++ {
+		icon.Image[i], icon.Delay[i] = prev, time.Duration(f.e.AnimationSpeed.Frame(i))*iconSpeedFrames*time.Second/videoFrameRate
+
+		format := f.e.IconGfxFormat.Frame(i)
+		if format == IconNone {
+			continue
+		}
+
+		img, err := decodeIcon(format, b[offsets[i]:], b[shared:])
+		if err != nil {
+			return nil, err
+		}
+
+		icon.Image[i], prev = img, img
+	}
+
+	return icon, nil
+}
+
+// gifColor rounds c to either fully transparent or fully opaque as GIF
+// doesn't support partial transparency.
+func gifColor(c color.Color) color.NRGBA {
+	n, _ := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if n.A < 0x80 { //nolint:gomnd
+		return color.NRGBA{}
+	}
+
+	n.A = 0xff
+
+	return n
+}
+
+// gifPalette returns a palette with a transparent first entry followed by
+// every other color used in img, or nil if there are too many.
+func gifPalette(img image.Image) color.Palette {
+	p := color.Palette{color.NRGBA{}}
+	seen := map[color.NRGBA]bool{{}: true}
+
+	bounds := img.Bounds()
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := gifColor(img.At(x, y))
+			if seen[c] {
+				continue
+			}
+
+			if len(p) == gifColors {
+				return nil
+			}
+
+			seen[c] = true
+			p = append(p, c)
+		}
+	}
+
+	return p
+}
+
+// gifFrame converts img to a paletted image suitable for a GIF. If img uses
+// too many colors then they are approximated with a fixed palette.
+func gifFrame(img image.Image) *image.Paletted {
+	p := gifPalette(img)
+	if p == nil {
+		p = append(color.Palette{color.NRGBA{}}, palette.Plan9[:gifColors-1]...)
+	}
+
+	bounds := img.Bounds()
+	frame := image.NewPaletted(bounds, p)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if c := gifColor(img.At(x, y)); c.A != 0 {
+				frame.SetColorIndex(x, y, uint8(1+p[1:].Index(c)))
+			}
+		}
+	}
+
+	return frame
+}
+
+// GIF returns the icon as an animated GIF that plays back the same way as
+// the IPL, looping forever. Each pixel is either fully transparent or fully
+// opaque, and a frame with more than 255 colors is approximated.
+func (i *Icon) GIF() *gif.GIF {
+	sequence := make([]int, 0, 2*len(i.Image))
+
+	for j := range i.Image {
+		sequence = append(sequence, j)
+	}
+
+	if i.PingPong {
+		for j := len(i.Image) - 2; j > 0; j-- {
+			sequence = append(sequence, j)
+		}
+	}
+
+	frames := make([]*image.Paletted, len(i.Image))
+	for j, img := range i.Image {
+		frames[j] = gifFrame(img)
+	}
+
+	g := new(gif.GIF)
+
+	for _, j := range sequence {
+		g.Image = append(g.Image, frames[j])
+		g.Delay = append(g.Delay, int((i.Delay[j]+gifDelayUnit/2)/gifDelayUnit))
+		g.Disposal = append(g.Disposal, gif.DisposalBackground)
+	}
+
+	return g
+}
@@ -0,0 +1,59 @@
+// Package cp1252 implements the Windows-1252 character encoding, as defined
+// by the WHATWG Encoding Standard.
+package cp1252
+
+import "strings"
+
+const (
+	tableFirst = 0x80
+	tableLast  = 0x9f
+)
+
+// The bytes 0x80 to 0x9f differ from ISO-8859-1, the five that are undefined
+// decode to the C1 control code of the same value.
+//
+//nolint:gochecknoglobals
+var table = [tableLast - tableFirst + 1]rune{
+	0x20ac, 0x0081, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008d, 0x017d, 0x008f,
+	0x0090, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0x009d, 0x017e, 0x0178,
+}
+
+// DecodeByte returns the rune for the Windows-1252 encoded byte b.
+func DecodeByte(b byte) rune {
+	if b >= tableFirst && b <= tableLast {
+		return table[b-tableFirst]
+	}
+
+	return rune(b)
+}
+
+// Decode converts the Windows-1252 encoded b to UTF-8.
+func Decode(b []byte) string {
+	sb := new(strings.Builder)
+	sb.Grow(len(b))
+
+	for _, c := range b {
+		sb.WriteRune(DecodeByte(c))
+	}
+
+	return sb.String()
+}
+
+// AppendRune appends the Windows-1252 encoding of r to the end of b and
+// returns the extended buffer. If r cannot be represented then b is returned
+// unchanged along with false.
+func AppendRune(b []byte, r rune) ([]byte, bool) {
+	if r < tableFirst || r > tableLast && r <= 0xff {
+		return append(b, byte(r)), true
+	}
+
+	for i, c := range table {
+		if c == r {
+			return append(b, byte(tableFirst+i)), true
+		}
+	}
+
+	return b, false
+}
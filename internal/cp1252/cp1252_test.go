@@ -0,0 +1,62 @@
+package cp1252_test
+
+import (
+	"testing"
+
+	"github.com/bodgit/gc/internal/cp1252"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{
+			name:  "ascii",
+			input: []byte("Game Data"),
+			want:  "Game Data",
+		},
+		{
+			name:  "windows-1252",
+			input: []byte{0x80, 0x99, 0x9f},
+			want:  "€™Ÿ",
+		},
+		{
+			name:  "latin-1",
+			input: []byte{0xe9, 0xfc},
+			want:  "éü",
+		},
+		{
+			name:  "undefined",
+			input: []byte{0x81},
+			want:  "\u0081",
+		},
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, table.want, cp1252.Decode(table.input))
+		})
+	}
+}
+
+func TestAppendRune(t *testing.T) {
+	t.Parallel()
+
+	for i := 0; i < 0x100; i++ {
+		b, ok := cp1252.AppendRune(nil, cp1252.DecodeByte(byte(i)))
+		assert.True(t, ok)
+		assert.Equal(t, []byte{byte(i)}, b)
+	}
+
+	b, ok := cp1252.AppendRune(nil, 'あ')
+	assert.False(t, ok)
+	assert.Nil(t, b)
+}
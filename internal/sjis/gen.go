@@ -0,0 +1,112 @@
+//go:build ignore
+
+// This program generates tables.go from the WHATWG index-jis0208.txt file.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const indexSize = 11104
+
+func open(name string) (io.ReadCloser, error) {
+	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		resp, err := http.Get(name) //nolint:gosec,noctx
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+
+			return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+		}
+
+		return resp.Body, nil
+	}
+
+	return os.Open(name)
+}
+
+func main() {
+	index := flag.String("index", "https://encoding.spec.whatwg.org/index-jis0208.txt", "URL or path of index")
+	output := flag.String("output", "tables.go", "output file")
+	flag.Parse()
+
+	rc, err := open(*index)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rc.Close()
+
+	var table [indexSize]uint16
+
+	s := bufio.NewScanner(rc)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		pointer, err := strconv.ParseUint(fields[0], 10, 16)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		r, err := strconv.ParseUint(fields[1], 0, 16)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if pointer < indexSize {
+			table[pointer] = uint16(r)
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintln(buf, "// Code generated by gen.go; DO NOT EDIT.")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "package sjis")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "// jis0208 maps a Shift-JIS pointer to a Unicode code point, 0 is unmapped.")
+	fmt.Fprintf(buf, "var jis0208 = [%d]uint16{", indexSize)
+
+	for i, r := range table {
+		if i%8 == 0 {
+			fmt.Fprintln(buf)
+		}
+
+		fmt.Fprintf(buf, "0x%04x, ", r)
+	}
+
+	fmt.Fprintln(buf, "\n}")
+
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(*output, b, 0o644); err != nil { //nolint:gosec
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,147 @@
+// Package sjis implements the Shift-JIS character encoding, as defined by the
+// WHATWG Encoding Standard.
+package sjis
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+//go:generate go run gen.go
+
+const (
+	halfwidthFirst = 0xa1
+	halfwidthLast  = 0xdf
+	halfwidthBase  = 0xff61
+
+	eudcFirst = 8836
+	eudcLast  = 10715
+	eudcBase  = 0xe000
+
+	trailsPerLead = 188
+
+	// Pointers in this range duplicate the IBM extensions found later in
+	// the index and are never used when encoding.
+	necFirst = 8272
+	necLast  = 8835
+
+	minus = 0x2212
+)
+
+//nolint:gochecknoglobals
+var (
+	encodeOnce  sync.Once
+	encodeTable map[rune]uint16
+)
+
+func buildEncodeTable() {
+	encodeTable = make(map[rune]uint16, len(jis0208))
+
+	for p, r := range jis0208 {
+		if r == 0 || p >= necFirst && p <= necLast {
+			continue
+		}
+
+		if _, ok := encodeTable[rune(r)]; !ok {
+			encodeTable[rune(r)] = uint16(p)
+		}
+	}
+}
+
+func isLead(b byte) bool {
+	return b >= 0x81 && b <= 0x9f || b >= 0xe0 && b <= 0xfc
+}
+
+func isTrail(b byte) bool {
+	return b >= 0x40 && b <= 0x7e || b >= 0x80 && b <= 0xfc
+}
+
+func pointer(lead, trail byte) int {
+	offset, trailOffset := 0x81, 0x40
+	if lead >= 0xa0 {
+		offset = 0xc1
+	}
+
+	if trail >= 0x7f {
+		trailOffset = 0x41
+	}
+
+	return (int(lead)-offset)*trailsPerLead + int(trail) - trailOffset
+}
+
+// DecodeRune unpacks the first Shift-JIS encoded character in b and returns
+// the rune and its width in bytes. If the encoding is invalid it returns
+// (utf8.RuneError, 1).
+func DecodeRune(b []byte) (rune, int) {
+	switch {
+	case len(b) == 0:
+		return utf8.RuneError, 0
+	case b[0] <= 0x80:
+		return rune(b[0]), 1
+	case b[0] >= halfwidthFirst && b[0] <= halfwidthLast:
+		return halfwidthBase + rune(b[0]-halfwidthFirst), 1
+	case !isLead(b[0]) || len(b) < 2 || !isTrail(b[1]):
+		return utf8.RuneError, 1
+	}
+
+	p := pointer(b[0], b[1])
+
+	switch {
+	case p >= eudcFirst && p <= eudcLast:
+		return eudcBase + rune(p-eudcFirst), 2 //nolint:gomnd
+	case p < len(jis0208) && jis0208[p] != 0:
+		return rune(jis0208[p]), 2 //nolint:gomnd
+	default:
+		return utf8.RuneError, 1
+	}
+}
+
+// Decode converts the Shift-JIS encoded b to UTF-8. Invalid bytes are
+// replaced with utf8.RuneError.
+func Decode(b []byte) string {
+	sb := new(strings.Builder)
+	sb.Grow(len(b))
+
+	for len(b) > 0 {
+		r, size := DecodeRune(b)
+		sb.WriteRune(r)
+		b = b[size:]
+	}
+
+	return sb.String()
+}
+
+// AppendRune appends the Shift-JIS encoding of r to the end of b and returns
+// the extended buffer. If r cannot be represented then b is returned
+// unchanged along with false.
+func AppendRune(b []byte, r rune) ([]byte, bool) {
+	switch {
+	case r <= 0x80:
+		return append(b, byte(r)), true
+	case r >= halfwidthBase && r <= halfwidthBase+halfwidthLast-halfwidthFirst:
+		return append(b, byte(r-halfwidthBase+halfwidthFirst)), true
+	case r == minus:
+		r = 0xff0d
+	}
+
+	encodeOnce.Do(buildEncodeTable)
+
+	p, ok := encodeTable[r]
+	if !ok {
+		return b, false
+	}
+
+	lead, trail := p/trailsPerLead, p%trailsPerLead
+
+	leadOffset, trailOffset := uint16(0x81), uint16(0x40)
+	if lead >= 0x1f {
+		leadOffset = 0xc1
+	}
+
+	if trail >= 0x3f {
+		trailOffset = 0x41
+	}
+
+	return append(b, byte(lead+leadOffset), byte(trail+trailOffset)), true
+}
@@ -0,0 +1,149 @@
+package sjis_test
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/bodgit/gc/internal/sjis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{
+			name:  "ascii",
+			input: []byte("Game Data"),
+			want:  "Game Data",
+		},
+		{
+			name:  "hiragana",
+			input: []byte{0x82, 0xa0, 0x82, 0xa2, 0x82, 0xa4},
+			want:  "あいう",
+		},
+		{
+			name:  "kanji",
+			input: []byte{0x93, 0xfa, 0x96, 0x7b},
+			want:  "日本",
+		},
+		{
+			name:  "halfwidth katakana",
+			input: []byte{0xb1, 0xb2},
+			want:  "ｱｲ",
+		},
+		{
+			name:  "truncated",
+			input: []byte{'A', 0x82},
+			want:  "A" + string(utf8.RuneError),
+		},
+		{
+			name:  "invalid trail",
+			input: []byte{0x82, 0x20},
+			want:  string(utf8.RuneError) + " ",
+		},
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, table.want, sjis.Decode(table.input))
+		})
+	}
+}
+
+func TestAppendRune(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name  string
+		input rune
+		want  []byte
+		ok    bool
+	}{
+		{
+			name:  "ascii",
+			input: 'A',
+			want:  []byte{'A'},
+			ok:    true,
+		},
+		{
+			name:  "hiragana",
+			input: 'あ',
+			want:  []byte{0x82, 0xa0},
+			ok:    true,
+		},
+		{
+			name:  "kanji",
+			input: '本',
+			want:  []byte{0x96, 0x7b},
+			ok:    true,
+		},
+		{
+			name:  "upper lead byte",
+			input: '漾',
+			want:  []byte{0xe0, 0x40},
+			ok:    true,
+		},
+		{
+			name:  "halfwidth katakana",
+			input: 'ｱ',
+			want:  []byte{0xb1},
+			ok:    true,
+		},
+		{
+			name:  "ibm extension",
+			input: 'ⅰ',
+			want:  []byte{0xfa, 0x40},
+			ok:    true,
+		},
+		{
+			name:  "unrepresentable",
+			input: 'é',
+			ok:    false,
+		},
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.name, func(t *testing.T) {
+			t.Parallel()
+
+			b, ok := sjis.AppendRune(nil, table.input)
+			assert.Equal(t, table.ok, ok)
+			assert.Equal(t, table.want, b)
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for lead := 0x81; lead <= 0xfc; lead++ {
+		for trail := 0x40; trail <= 0xfc; trail++ {
+			in := []byte{byte(lead), byte(trail)}
+
+			r, size := sjis.DecodeRune(in)
+			if size != len(in) {
+				continue
+			}
+
+			b, ok := sjis.AppendRune(nil, r)
+			if !ok {
+				// Only the user-defined area doesn't encode
+				assert.True(t, r >= 0xe000 && r <= 0xf8ff, "%#x", in)
+
+				continue
+			}
+
+			r2, _ := sjis.DecodeRune(b)
+			assert.Equal(t, r, r2, "%#x", in)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Package texture decodes the GameCube texture formats used by memory card
+// banners and icons.
+package texture
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+)
+
+// Textures are stored as a sequence of 32 byte tiles, partial tiles at the
+// right and bottom edges are padded.
+const (
+	rgb5a3TileSize = 4 // 4x4 pixels, two bytes each
+	ci8TileWidth   = 8 // 8x4 pixels, one byte each
+	ci8TileHeight  = 4
+	paletteEntries = 256
+
+	// PaletteSize is the size of a CI8 palette in bytes.
+	PaletteSize = paletteEntries * 2
+)
+
+var errShortData = errors.New("texture: not enough data")
+
+func roundUp(x, n int) int {
+	return (x + n - 1) / n * n
+}
+
+// RGB5A3 converts a single RGB5A3 texel. If the top bit is set it is opaque
+// with five bits per channel, otherwise it has three bits of alpha and four
+// bits per channel.
+//
+//nolint:gomnd
+func RGB5A3(v uint16) color.NRGBA {
+	if v&0x8000 != 0 {
+		r, g, b := uint8(v>>10)&0x1f, uint8(v>>5)&0x1f, uint8(v)&0x1f
+
+		return color.NRGBA{r<<3 | r>>2, g<<3 | g>>2, b<<3 | b>>2, 0xff}
+	}
+
+	a, r, g, b := uint8(v>>12)&0x07, uint8(v>>8)&0x0f, uint8(v>>4)&0x0f, uint8(v)&0x0f
+
+	return color.NRGBA{r * 0x11, g * 0x11, b * 0x11, a<<5 | a<<2 | a>>1}
+}
+
+// DecodeRGB5A3 decodes a w by h RGB5A3 texture from b, which is stored as 4x4
+// tiles.
+func DecodeRGB5A3(b []byte, w, h int) (*image.NRGBA, error) {
+	if len(b) < roundUp(w, rgb5a3TileSize)*roundUp(h, rgb5a3TileSize)*2 {
+		return nil, errShortData
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	for ty := 0; ty < h; ty += rgb5a3TileSize {
+		for tx := 0; tx < w; tx += rgb5a3TileSize {
+			for y := ty; y < ty+rgb5a3TileSize; y++ {
+				for x := tx; x < tx+rgb5a3TileSize; x++ {
+					img.SetNRGBA(x, y, RGB5A3(binary.BigEndian.Uint16(b)))
+					b = b[2:]
+				}
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// DecodePalette decodes a CI8 palette of 256 RGB5A3 entries from b.
+func DecodePalette(b []byte) (color.Palette, error) {
+	if len(b) < PaletteSize {
+		return nil, errShortData
+	}
+
+	p := make(color.Palette, paletteEntries)
+	for i := range p {
+		p[i] = RGB5A3(binary.BigEndian.Uint16(b[i*2:]))
+	}
+
+	return p, nil
+}
+
+// DecodeCI8 decodes a w by h CI8 texture from b, which is stored as 8x4
+// tiles, using the palette p.
+func DecodeCI8(b []byte, p color.Palette, w, h int) (*image.Paletted, error) {
+	if len(b) < roundUp(w, ci8TileWidth)*roundUp(h, ci8TileHeight) {
+		return nil, errShortData
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, w, h), p)
+
+	for ty := 0; ty < h; ty += ci8TileHeight {
+		for tx := 0; tx < w; tx += ci8TileWidth {
+			for y := ty; y < ty+ci8TileHeight; y++ {
+				for x := tx; x < tx+ci8TileWidth; x++ {
+					img.SetColorIndex(x, y, b[0])
+					b = b[1:]
+				}
+			}
+		}
+	}
+
+	return img, nil
+}
@@ -0,0 +1,102 @@
+package texture_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/bodgit/gc/internal/texture"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRGB5A3(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name  string
+		input uint16
+		want  color.NRGBA
+	}{
+		{
+			name:  "opaque white",
+			input: 0xffff,
+			want:  color.NRGBA{0xff, 0xff, 0xff, 0xff},
+		},
+		{
+			name:  "opaque red",
+			input: 0xfc00,
+			want:  color.NRGBA{0xff, 0x00, 0x00, 0xff},
+		},
+		{
+			name:  "transparent",
+			input: 0x0000,
+			want:  color.NRGBA{0x00, 0x00, 0x00, 0x00},
+		},
+		{
+			name:  "translucent blue",
+			input: 0x400f,
+			want:  color.NRGBA{0x00, 0x00, 0xff, 0x92},
+		},
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, table.want, texture.RGB5A3(table.input))
+		})
+	}
+}
+
+func TestDecodeRGB5A3(t *testing.T) {
+	t.Parallel()
+
+	// Two 4x4 tiles, the first opaque white and the second transparent
+	b := make([]byte, 2*4*4*2)
+	for i := 0; i < 4*4*2; i += 2 {
+		b[i], b[i+1] = 0xff, 0xff
+	}
+
+	img, err := texture.DecodeRGB5A3(b, 8, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, image.Rect(0, 0, 8, 4), img.Bounds())
+	assert.Equal(t, color.NRGBA{0xff, 0xff, 0xff, 0xff}, img.NRGBAAt(3, 3))
+	assert.Equal(t, color.NRGBA{}, img.NRGBAAt(4, 0))
+
+	_, err = texture.DecodeRGB5A3(b[:len(b)-1], 8, 4)
+	assert.Error(t, err)
+}
+
+func TestDecodeCI8(t *testing.T) {
+	t.Parallel()
+
+	pb := make([]byte, texture.PaletteSize)
+	pb[2], pb[3] = 0xfc, 0x00 // Index 1 is opaque red
+
+	p, err := texture.DecodePalette(pb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two 8x4 tiles, only the last pixel of the second is red
+	b := make([]byte, 2*8*4)
+	b[len(b)-1] = 1
+
+	img, err := texture.DecodeCI8(b, p, 8, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, image.Rect(0, 0, 8, 8), img.Bounds())
+	assert.Equal(t, uint8(1), img.ColorIndexAt(7, 7))
+	assert.Equal(t, uint8(0), img.ColorIndexAt(0, 4))
+
+	_, err = texture.DecodeCI8(b[:len(b)-1], p, 8, 8)
+	assert.Error(t, err)
+
+	_, err = texture.DecodePalette(pb[:len(pb)-1])
+	assert.Error(t, err)
+}
@@ -6,6 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"sort"
+	"strings"
 )
 
 // Based on http://hitmen.c02.at/files/yagcd/yagcd/chap12.html#sec12 and
@@ -45,11 +48,20 @@ const (
 )
 
 var (
-	errInvalidBlockMapCounters  = errors.New("invalid block allocation map update counters")
-	errInvalidCapacity          = errors.New("not a valid capacity")
-	errInvalidDirectoryCounters = errors.New("invalid directory update counters")
-	errInvalidEncoding          = errors.New("not a valid encoding")
-	errTrailingBytes            = errors.New("trailing bytes")
+	// ErrInvalidBlockMapCounters is returned when the update counters of
+	// the two block allocation maps are not consecutive.
+	ErrInvalidBlockMapCounters = errors.New("invalid block allocation map update counters")
+	// ErrInvalidCapacity is returned for an unsupported memory card size.
+	ErrInvalidCapacity = errors.New("not a valid capacity")
+	// ErrInvalidDirectoryCounters is returned when the update counters of
+	// the two directories are not consecutive.
+	ErrInvalidDirectoryCounters = errors.New("invalid directory update counters")
+	// ErrInvalidEncoding is returned for an unsupported memory card
+	// encoding.
+	ErrInvalidEncoding = errors.New("not a valid encoding")
+	// ErrTrailingBytes is returned when there is more data than the size
+	// of the memory card requires.
+	ErrTrailingBytes = errors.New("trailing bytes")
 )
 
 type memoryCard struct {
@@ -57,23 +69,64 @@ type memoryCard struct {
 	directory [copies]directory
 	blockMap  [copies]blockMap
 
+	// Data blocks are either held in memory or read on demand from ra
 	blocks [][blockSize]byte
+	ra     io.ReaderAt
+
+	// Copies that failed validation and must not be used
+	badDirectory [copies]bool
+	badBlockMap  [copies]bool
+
+	// Blocks changed since the image was read, numbered from the start
+	// of the card. Changed directory and block allocation map copies are
+	// kept in the order they were committed
+	dirty   map[int]struct{}
+	commits []int
 }
 
-func (mc *memoryCard) activeDirectory() int {
-	if mc.directory[backup].UpdateCounter > mc.directory[master].UpdateCounter {
+// newer returns true if update counter c1 is more recent than c2, allowing for
+// the counters wrapping around.
+func newer(c1, c2 uint16) bool {
+	return int16(c1-c2) > 0
+}
+
+// active returns which of the two copies of a structure, as described by
+// their update counters, is in use given which of them are damaged.
+func active(bad [copies]bool, counters [copies]uint16) int {
+	switch {
+	case bad[master] && !bad[backup]:
+		return backup
+	case bad[backup] && !bad[master]:
+		return master
+	case newer(counters[backup], counters[master]):
 		return backup
+	default:
+		return master
 	}
+}
 
-	return master
+func (mc *memoryCard) directoryCounters() [copies]uint16 {
+	return [copies]uint16{mc.directory[master].UpdateCounter, mc.directory[backup].UpdateCounter}
+}
+
+func (mc *memoryCard) blockMapCounters() [copies]uint16 {
+	return [copies]uint16{mc.blockMap[master].UpdateCounter, mc.blockMap[backup].UpdateCounter}
+}
+
+func (mc *memoryCard) activeDirectory() int {
+	return active(mc.badDirectory, mc.directoryCounters())
 }
 
 func (mc *memoryCard) activeBlockMap() int {
-	if mc.blockMap[backup].UpdateCounter > mc.blockMap[master].UpdateCounter {
-		return backup
+	return active(mc.badBlockMap, mc.blockMapCounters())
+}
+
+func copyName(i int) string {
+	if i == backup {
+		return "backup"
 	}
 
-	return master
+	return "master"
 }
 
 func (mc *memoryCard) size() int {
@@ -115,32 +168,366 @@ func (mc *memoryCard) checksum() error {
 	return nil
 }
 
-func (mc *memoryCard) isValid() error {
+// fsName returns the name of the entry as presented by the fs.FS of a Reader,
+// optionally within a directory named after its game and maker codes.
+func (mc *memoryCard) fsName(e *entry, groupByGame bool) string {
+	name := EscapeName(mc.header.Encoding, e.Filename[:])
+	if groupByGame {
+		name = EscapeName(mc.header.Encoding, append(e.GameCode[:], e.MakerCode[:]...)) + "/" + name
+	}
+
+	return name
+}
+
+// lookup returns the directory slot of the named file in the active
+// directory. The name is escaped as with EscapeName and may be prefixed by
+// the game and maker codes as a directory, as with the GroupByGame option.
+func (mc *memoryCard) lookup(name string) (int, error) {
+	d := &mc.directory[mc.activeDirectory()]
+	slot := -1
+
+	for i := range d.Entries {
+		e := &d.Entries[i]
+		if e.isEmpty() || mc.fsName(e, strings.Contains(name, "/")) != name {
+			continue
+		}
+
+		if slot >= 0 {
+			return -1, ErrDuplicateName
+		}
+
+		slot = i
+	}
+
+	if slot < 0 {
+		return -1, fs.ErrNotExist
+	}
+
+	return slot, nil
+}
+
+// conflicts returns true if any file, other than the one in the given slot,
+// has the same game code, maker code and filename as e.
+func (mc *memoryCard) conflicts(e *entry, slot int) bool {
+	for i, x := range mc.directory[mc.activeDirectory()].Entries {
+		if i == slot || x.isEmpty() {
+			continue
+		}
+
+		if x.GameCode == e.GameCode && x.MakerCode == e.MakerCode && x.filename() == e.filename() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// freeSlot returns the first unused slot in the active directory.
+func (mc *memoryCard) freeSlot() (int, bool) {
+	for i := range mc.directory[mc.activeDirectory()].Entries {
+		if mc.directory[mc.activeDirectory()].Entries[i].isEmpty() {
+			return i, true
+		}
+	}
+
+	return -1, false
+}
+
+// allocate finds n free blocks in the block allocation map m in the same way as
+// the IPL, scanning from the block after the last one allocated and wrapping
+// around at the end of the card. The blocks need not be contiguous.
+func (mc *memoryCard) allocate(m *blockMap, n int) ([]uint16, error) {
+	if n > int(m.FreeBlocks) {
+		return nil, ErrNoFreeSpace
+	}
+
+	blocks := make([]uint16, 0, n)
+	b := int(m.LastAllocatedBlock)
+
+	// As with the IPL, give up after a full lap of the data blocks
+	for count := 0; len(blocks) < n; count++ {
+		if count >= mc.header.blocks()-reservedBlocks {
+			return nil, ErrNoFreeSpace
+		}
+
+		if b++; b < reservedBlocks || b >= mc.header.blocks() {
+			b = reservedBlocks
+		}
+
+		if m.Blocks[b-reservedBlocks] == 0 {
+			blocks = append(blocks, uint16(b))
+		}
+	}
+
+	return blocks, nil
+}
+
+// addFile stores e in the given directory slot with its data read from r,
+// allocating a chain of blocks for it. If replace is true then the file
+// already in the slot is replaced, its blocks are only freed once the new
+// file is stored so there must be room for both. Nothing is changed unless
+// the blocks can be allocated and all of the data read. The
+// block allocation map is committed before the directory so an interrupted
+// write can only leak blocks.
+func (mc *memoryCard) addFile(slot int, e *entry, r io.Reader, replace bool) error {
+	d, m := mc.directory[mc.activeDirectory()], mc.blockMap[mc.activeBlockMap()]
+
+	var old []uint16
+
+	if replace {
+		var err error
+		if old, err = m.chain(d.Entries[slot].FirstBlock, mc.header.blocks()); err != nil {
+			return mc.chainError(mc.activeDirectory(), mc.activeBlockMap(), slot, old, err)
+		}
+	}
+
+	// The blocks of any file being replaced are still allocated so they
+	// aren't overwritten until the new file is stored
+	blocks, err := mc.allocate(&m, int(e.FileLength))
+	if err != nil {
+		return err
+	}
+
+	data := make([][blockSize]byte, len(blocks))
+	for i := range data {
+		if _, err := io.ReadFull(r, data[i][:]); err != nil {
+			return fmt.Errorf("unable to read: %w", err)
+		}
+	}
+
+	for i, b := range blocks {
+		mc.blocks[b-reservedBlocks] = data[i]
+		mc.touch(int(b))
+	}
+
+	for _, b := range old {
+		m.Blocks[b-reservedBlocks] = 0
+	}
+
+	m.FreeBlocks += uint16(len(old))
+
+	for i, b := range blocks {
+		if i+1 < len(blocks) {
+			m.Blocks[b-reservedBlocks] = blocks[i+1]
+		} else {
+			m.Blocks[b-reservedBlocks] = lastBlock
+		}
+	}
+
+	m.FreeBlocks -= uint16(len(blocks))
+	m.LastAllocatedBlock = blocks[len(blocks)-1]
+
+	if err := mc.commitBlockMap(m); err != nil {
+		return err
+	}
+
+	e.FirstBlock = blocks[0]
+	d.Entries[slot] = *e
+
+	return mc.commitDirectory(d)
+}
+
+// removeFile clears the entry in the given directory slot and frees the chain
+// of blocks used by the file. The directory is committed before the block
+// allocation map so an interrupted write can only leak blocks.
+func (mc *memoryCard) removeFile(slot int) error {
+	d, m := mc.directory[mc.activeDirectory()], mc.blockMap[mc.activeBlockMap()]
+
+	chain, err := m.chain(d.Entries[slot].FirstBlock, mc.header.blocks())
+	if err != nil {
+		return mc.chainError(mc.activeDirectory(), mc.activeBlockMap(), slot, chain, err)
+	}
+
+	d.Entries[slot] = newEntry()
+
+	if err := mc.commitDirectory(d); err != nil {
+		return err
+	}
+
+	for _, b := range chain {
+		m.Blocks[b-reservedBlocks] = 0
+	}
+
+	m.FreeBlocks += uint16(len(chain))
+
+	return mc.commitBlockMap(m)
+}
+
+// validCounters checks the update counters of the two copies of a structure
+// differ by one, allowing for the counters wrapping around.
+func validCounters(c1, c2 uint16) bool {
+	return c1-c2 == 1 || c2-c1 == 1
+}
+
+// commitDirectory writes d to the inactive copy of the directory with the next
+// update counter, which makes it the active copy. The previous copy is left
+// untouched as a fallback, as the IPL does.
+func (mc *memoryCard) commitDirectory(d directory) error {
+	active := mc.activeDirectory()
+
+	d.UpdateCounter = mc.directory[active].UpdateCounter + 1
+	if err := d.checksum(); err != nil {
+		return err
+	}
+
+	mc.directory[active^1], mc.badDirectory[active^1] = d, false
+	mc.touch(StructureDirectory.block(active ^ 1))
+
+	return nil
+}
+
+// commitBlockMap writes m to the inactive copy of the block allocation map in
+// the same way as commitDirectory.
+func (mc *memoryCard) commitBlockMap(m blockMap) error {
+	active := mc.activeBlockMap()
+
+	m.UpdateCounter = mc.blockMap[active].UpdateCounter + 1
+	if err := m.checksum(); err != nil {
+		return err
+	}
+
+	mc.blockMap[active^1], mc.badBlockMap[active^1] = m, false
+	mc.touch(StructureBlockMap.block(active ^ 1))
+
+	return nil
+}
+
+// touch marks block i, numbered from the start of the card, as changed.
+func (mc *memoryCard) touch(i int) {
+	if i < reservedBlocks {
+		for j, c := range mc.commits {
+			if c == i {
+				mc.commits = append(mc.commits[:j], mc.commits[j+1:]...)
+
+				break
+			}
+		}
+
+		mc.commits = append(mc.commits, i)
+
+		return
+	}
+
+	if mc.dirty == nil {
+		mc.dirty = make(map[int]struct{})
+	}
+
+	mc.dirty[i] = struct{}{}
+}
+
+func (mc *memoryCard) headerError() error {
 	if err := mc.header.isValid(); err != nil {
+		return newCorruptionError(StructureHeader, master, -1, headerChecksumOffset, err)
+	}
+
+	return nil
+}
+
+func (mc *memoryCard) directoryError(i int) error {
+	if err := mc.directory[i].isValid(); err != nil {
+		return newCorruptionError(StructureDirectory, i, -1, directoryChecksumOffset, err)
+	}
+
+	return nil
+}
+
+func (mc *memoryCard) blockMapError(i int) error {
+	if err := mc.blockMap[i].isValid(); err != nil {
+		return newCorruptionError(StructureBlockMap, i, -1, blockMapChecksumOffset, err)
+	}
+
+	return nil
+}
+
+// directoryCountersError and blockMapCountersError blame the inactive copy
+// for a mismatched pair of update counters.
+func (mc *memoryCard) directoryCountersError() error {
+	if !validCounters(mc.directory[master].UpdateCounter, mc.directory[backup].UpdateCounter) {
+		return newCorruptionError(StructureDirectory, mc.activeDirectory()^1, -1,
+			directoryUpdateCounterOffset, ErrInvalidDirectoryCounters)
+	}
+
+	return nil
+}
+
+func (mc *memoryCard) blockMapCountersError() error {
+	if !validCounters(mc.blockMap[master].UpdateCounter, mc.blockMap[backup].UpdateCounter) {
+		return newCorruptionError(StructureBlockMap, mc.activeBlockMap()^1, -1,
+			blockMapUpdateCounterOffset, ErrInvalidBlockMapCounters)
+	}
+
+	return nil
+}
+
+func (mc *memoryCard) isValid() error {
+	if err := mc.headerError(); err != nil {
 		return err
 	}
 
 	for i := 0; i < copies; i++ {
-		if err := mc.directory[i].isValid(); err != nil {
+		if err := mc.directoryError(i); err != nil {
 			return err
 		}
 
-		if err := mc.blockMap[i].isValid(); err != nil {
+		if err := mc.blockMapError(i); err != nil {
 			return err
 		}
 	}
 
-	diff := int(mc.directory[master].UpdateCounter) - int(mc.directory[backup].UpdateCounter)
-	if diff != 1 && diff != -1 {
-		return errInvalidDirectoryCounters
+	if err := mc.directoryCountersError(); err != nil {
+		return err
 	}
 
-	diff = int(mc.blockMap[master].UpdateCounter) - int(mc.blockMap[backup].UpdateCounter)
-	if diff != 1 && diff != -1 {
-		return errInvalidBlockMapCounters
+	return mc.blockMapCountersError()
+}
+
+// salvage is a lenient alternative to isValid. Each copy of the directory and
+// block allocation map is checked on its own and any damaged copy is marked
+// so that the other copy is used instead, regardless of the update counters.
+// The problems that were tolerated are returned, an error is only returned if
+// there is no usable copy of a structure.
+//
+//nolint:cyclop
+func (mc *memoryCard) salvage() ([]error, error) {
+	var skipped []error
+
+	if err := mc.headerError(); err != nil {
+		skipped = append(skipped, err)
 	}
 
-	return nil
+	for i := 0; i < copies; i++ {
+		if err := mc.directoryError(i); err != nil {
+			mc.badDirectory[i] = true
+			skipped = append(skipped, err)
+		}
+
+		if err := mc.blockMapError(i); err != nil {
+			mc.badBlockMap[i] = true
+			skipped = append(skipped, err)
+		}
+	}
+
+	if mc.badDirectory[master] && mc.badDirectory[backup] {
+		return skipped, mc.directoryError(mc.activeDirectory())
+	}
+
+	if mc.badBlockMap[master] && mc.badBlockMap[backup] {
+		return skipped, mc.blockMapError(mc.activeBlockMap())
+	}
+
+	if !mc.badDirectory[master] && !mc.badDirectory[backup] {
+		if err := mc.directoryCountersError(); err != nil {
+			skipped = append(skipped, err)
+		}
+	}
+
+	if !mc.badBlockMap[master] && !mc.badBlockMap[backup] {
+		if err := mc.blockMapCountersError(); err != nil {
+			skipped = append(skipped, err)
+		}
+	}
+
+	return skipped, nil
 }
 
 func validateCardSize(capacity uint16) error {
@@ -153,7 +540,7 @@ func validateCardSize(capacity uint16) error {
 	case MemoryCard2043:
 		break
 	default:
-		return errInvalidCapacity
+		return ErrInvalidCapacity
 	}
 
 	return nil
@@ -165,23 +552,23 @@ func validateEncoding(encoding uint16) error {
 	case EncodingSJIS:
 		break
 	default:
-		return errInvalidEncoding
+		return ErrInvalidEncoding
 	}
 
 	return nil
 }
 
-func (mc *memoryCard) unmarshalBinary(r io.Reader) error {
+func (mc *memoryCard) unmarshalMetadata(r io.Reader) error {
 	if err := binary.Read(r, binary.BigEndian, &mc.header); err != nil {
 		return fmt.Errorf("unable to read header: %w", err)
 	}
 
 	if err := validateCardSize(mc.header.CardSize); err != nil {
-		return err
+		return newCorruptionError(StructureHeader, master, -1, headerCardSizeOffset, err)
 	}
 
 	if err := validateEncoding(mc.header.Encoding); err != nil {
-		return err
+		return newCorruptionError(StructureHeader, master, -1, headerEncodingOffset, err)
 	}
 
 	if err := binary.Read(r, binary.BigEndian, &mc.directory); err != nil {
@@ -192,6 +579,14 @@ func (mc *memoryCard) unmarshalBinary(r io.Reader) error {
 		return fmt.Errorf("unable to read block map: %w", err)
 	}
 
+	return nil
+}
+
+func (mc *memoryCard) unmarshalBinary(r io.Reader) error {
+	if err := mc.unmarshalMetadata(r); err != nil {
+		return err
+	}
+
 	mc.blocks = make([][blockSize]byte, mc.header.blocks()-reservedBlocks)
 
 	for i := range mc.blocks {
@@ -201,52 +596,134 @@ func (mc *memoryCard) unmarshalBinary(r io.Reader) error {
 	}
 
 	if n, _ := io.CopyN(io.Discard, r, 1); n > 0 {
-		return errTrailingBytes
+		return ErrTrailingBytes
 	}
 
-	return mc.isValid()
+	return nil
+}
+
+// unmarshalBinaryAt reads only the header, directory and block allocation map
+// from r, the data blocks are read on demand.
+func (mc *memoryCard) unmarshalBinaryAt(r io.ReaderAt, size int64) error {
+	if err := mc.unmarshalMetadata(io.NewSectionReader(r, 0, size)); err != nil {
+		return err
+	}
+
+	switch {
+	case size > int64(mc.size()):
+		return ErrTrailingBytes
+	case size < int64(mc.size()):
+		return fmt.Errorf("unable to read block: %w", io.ErrUnexpectedEOF)
+	}
+
+	mc.ra = r
+
+	return nil
+}
+
+// blockReader returns a reader for data block i, which is either held in
+// memory or read on demand from the underlying io.ReaderAt.
+func (mc *memoryCard) blockReader(i int) *io.SectionReader {
+	if mc.ra != nil {
+		return io.NewSectionReader(mc.ra, int64(reservedBlocks+i)*blockSize, blockSize)
+	}
+
+	return io.NewSectionReader(bytes.NewReader(mc.blocks[i][:]), 0, blockSize)
 }
 
 func (mc *memoryCard) UnmarshalBinary(b []byte) error {
 	r := bytes.NewReader(b)
 
-	return mc.unmarshalBinary(r)
+	if err := mc.unmarshalBinary(r); err != nil {
+		return err
+	}
+
+	return mc.isValid()
 }
 
 func (mc *memoryCard) MarshalBinary() ([]byte, error) {
 	buf := new(bytes.Buffer)
 	buf.Grow(mc.size())
 
-	b, err := mc.header.MarshalBinary()
-	if err != nil {
+	if _, err := mc.WriteTo(buf); err != nil {
 		return nil, err
 	}
 
-	_, _ = buf.Write(b)
+	return buf.Bytes(), nil
+}
 
-	for i := 0; i < copies; i++ {
-		b, err = mc.directory[i].MarshalBinary()
+// block returns the contents of block i, numbered from the start of the card.
+func (mc *memoryCard) block(i int) ([]byte, error) {
+	switch {
+	case i == 0:
+		return mc.header.MarshalBinary()
+	case i < StructureBlockMap.block(master):
+		return mc.directory[i-StructureDirectory.block(master)].MarshalBinary()
+	case i < reservedBlocks:
+		return mc.blockMap[i-StructureBlockMap.block(master)].MarshalBinary()
+	default:
+		return mc.blocks[i-reservedBlocks][:], nil
+	}
+}
+
+// WriteTo writes the memory card image to w one block at a time, rather than
+// building the whole image in memory first.
+func (mc *memoryCard) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+
+	for i := 0; i < mc.header.blocks(); i++ {
+		b, err := mc.block(i)
 		if err != nil {
-			return nil, err
+			return n, err
 		}
 
-		_, _ = buf.Write(b)
-	}
+		m, err := w.Write(b)
+		n += int64(m)
+
+		if err == nil && m < len(b) {
+			err = io.ErrShortWrite
+		}
 
-	for i := 0; i < copies; i++ {
-		b, err = mc.blockMap[i].MarshalBinary()
 		if err != nil {
-			return nil, err
+			return n, fmt.Errorf("unable to write: %w", err)
 		}
+	}
 
-		_, _ = buf.Write(b)
+	return n, nil
+}
+
+// writeAt writes just the blocks changed since the image was read, or since
+// the last call, to w which should hold the original image. The data blocks
+// are written first so they are in place before the block allocation map and
+// directory that refer to them, which are then written in the order they were
+// committed. This preserves the ordering that means an interrupted write can
+// only leak blocks.
+func (mc *memoryCard) writeAt(w io.WriterAt) error {
+	dirty := make([]int, 0, len(mc.dirty)+len(mc.commits))
+	for i := range mc.dirty {
+		dirty = append(dirty, i)
 	}
 
-	for i := range mc.blocks {
-		_, _ = buf.Write(mc.blocks[i][:])
+	sort.Ints(dirty)
+
+	dirty = append(dirty, mc.commits...)
+
+	for _, i := range dirty {
+		b, err := mc.block(i)
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.WriteAt(b, int64(i)*blockSize); err != nil {
+			return fmt.Errorf("unable to write: %w", err)
+		}
+
+		delete(mc.dirty, i)
 	}
 
-	return buf.Bytes(), nil
+	mc.commits = nil
+
+	return nil
 }
 
 func newMemoryCard(flashID [12]byte, formatTime uint64, capacity, encoding uint16) (*memoryCard, error) {
@@ -282,10 +759,7 @@ func newMemoryCard(flashID [12]byte, formatTime uint64, capacity, encoding uint1
 
 	mc.blocks = make([][blockSize]byte, freeBlocks)
 	for i := range mc.blocks {
-		mc.blocks[i][0] = 0xff
-		for j := 1; j < len(mc.blocks[i]); j *= 2 {
-			copy(mc.blocks[i][j:], mc.blocks[i][:j])
-		}
+		erase(&mc.blocks[i])
 	}
 
 	if err := mc.checksum(); err != nil {
@@ -295,6 +769,14 @@ func newMemoryCard(flashID [12]byte, formatTime uint64, capacity, encoding uint1
 	return mc, nil
 }
 
+// erase fills b with 0xff, as with an erased flash block.
+func erase(b *[blockSize]byte) {
+	b[0] = 0xff
+	for j := 1; j < len(b); j *= 2 {
+		copy(b[j:], b[:j])
+	}
+}
+
 // DetectMemoryCard works out if the io.ReaderAt r pointing to the data of size
 // bytes looks sufficiently like a GameCube memory card image.
 func DetectMemoryCard(r io.ReaderAt, size int64) (bool, error) {
@@ -0,0 +1,211 @@
+package gc
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounters(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		c1, c2 uint16
+		newer  bool
+		valid  bool
+	}{
+		{1, 0, true, true},
+		{0, 1, false, true},
+		{5, 3, true, false},
+		{3, 3, false, false},
+		{0x0000, 0xffff, true, true},
+		{0xffff, 0x0000, false, true},
+		{0x8000, 0x0000, false, false},
+	}
+
+	for _, table := range tables {
+		assert.Equal(t, table.newer, newer(table.c1, table.c2), "%#04x %#04x", table.c1, table.c2)
+		assert.Equal(t, table.valid, validCounters(table.c1, table.c2), "%#04x %#04x", table.c1, table.c2)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	t.Parallel()
+
+	b, err := os.ReadFile(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mc := new(memoryCard)
+	if err := mc.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	// Force the counters to be about to wrap
+	d, m := mc.activeDirectory(), mc.activeBlockMap()
+	mc.directory[d].UpdateCounter, mc.directory[d^1].UpdateCounter = 0xffff, 0xfffe
+	mc.blockMap[m].UpdateCounter, mc.blockMap[m^1].UpdateCounter = 0xffff, 0xfffe
+
+	if err := mc.checksum(); err != nil {
+		t.Fatal(err)
+	}
+
+	oldDirectory, oldBlockMap := mc.directory[d], mc.blockMap[m]
+
+	slot, err := mc.lookup("gczelda")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mc.removeFile(slot); err != nil {
+		t.Fatal(err)
+	}
+
+	// The update went to the other copies which are now active, the
+	// previous copies are untouched
+	assert.Equal(t, d^1, mc.activeDirectory())
+	assert.Equal(t, m^1, mc.activeBlockMap())
+	assert.Equal(t, uint16(0), mc.directory[d^1].UpdateCounter)
+	assert.Equal(t, uint16(0), mc.blockMap[m^1].UpdateCounter)
+	assert.Equal(t, oldDirectory, mc.directory[d])
+	assert.Equal(t, oldBlockMap, mc.blockMap[m])
+	assert.Nil(t, mc.isValid())
+
+	// A second update goes back to the original copies
+	slot, err = mc.lookup("fzc.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mc.removeFile(slot); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, d, mc.activeDirectory())
+	assert.Equal(t, m, mc.activeBlockMap())
+	assert.Equal(t, uint16(1), mc.directory[d].UpdateCounter)
+	assert.Nil(t, mc.isValid())
+
+	nb, err := mc.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(nb))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, r.File, 5)
+	assert.True(t, r.Verify().OK())
+}
+
+// lap returns every data block of a 59 block card, starting from first and
+// wrapping around.
+func lap(first uint16) []uint16 {
+	blocks := make([]uint16, 0, 64-reservedBlocks)
+
+	for b := first; len(blocks) < cap(blocks); b++ {
+		if b == 64 {
+			b = reservedBlocks
+		}
+
+		blocks = append(blocks, b)
+	}
+
+	return blocks
+}
+
+func TestAllocate(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name          string
+		lastAllocated uint16
+		used          []uint16
+		n             int
+		blocks        []uint16
+		err           error
+	}{
+		{
+			name:          "blank",
+			lastAllocated: reservedBlocks - 1,
+			n:             3,
+			blocks:        []uint16{5, 6, 7},
+		},
+		{
+			name:          "after last allocated",
+			lastAllocated: 20,
+			n:             2,
+			blocks:        []uint16{21, 22},
+		},
+		{
+			name:          "skip used",
+			lastAllocated: 20,
+			used:          []uint16{22, 23},
+			n:             3,
+			blocks:        []uint16{21, 24, 25},
+		},
+		{
+			name:          "wrap",
+			lastAllocated: 61,
+			used:          []uint16{5},
+			n:             4,
+			blocks:        []uint16{62, 63, 6, 7},
+		},
+		{
+			name:          "out of range",
+			lastAllocated: 0x1000,
+			n:             1,
+			blocks:        []uint16{5},
+		},
+		{
+			name:          "too big",
+			lastAllocated: reservedBlocks - 1,
+			n:             60,
+			err:           ErrNoFreeSpace,
+		},
+		{
+			name:          "only last allocated is free",
+			lastAllocated: 30,
+			used:          lap(31)[:58],
+			n:             1,
+			blocks:        []uint16{30},
+		},
+		{
+			name:          "every block",
+			lastAllocated: 30,
+			n:             59,
+			blocks:        lap(31),
+		},
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.name, func(t *testing.T) {
+			t.Parallel()
+
+			mc, err := newMemoryCard([12]byte{}, 0, MemoryCard59, EncodingANSI)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m := &mc.blockMap[mc.activeBlockMap()]
+			m.LastAllocatedBlock = table.lastAllocated
+
+			for _, b := range table.used {
+				m.Blocks[b-reservedBlocks] = lastBlock
+			}
+
+			m.FreeBlocks = m.freeBlocks(mc.header.blocks())
+
+			blocks, err := mc.allocate(m, table.n)
+			assert.Equal(t, table.blocks, blocks)
+			assert.ErrorIs(t, err, table.err)
+		})
+	}
+}
@@ -21,7 +21,7 @@ func patchFZero(r io.Reader, mc *memoryCard) (io.Reader, error) {
 	}
 
 	if len(b) < lengthFZero {
-		return nil, errInvalidLength
+		return nil, ErrInvalidLength
 	}
 
 	b[0x2066] = byte(serial1 >> 24)
@@ -75,7 +75,7 @@ func patchPSO(r io.Reader, mc *memoryCard, offset int) (io.Reader, error) {
 	}
 
 	if len(b) < lengthPSO {
-		return nil, errInvalidLength
+		return nil, ErrInvalidLength
 	}
 
 	b[0x2158] = byte(serial1 >> 24)
@@ -1,7 +1,6 @@
 package gc
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -10,56 +9,187 @@ import (
 	"os"
 	"path"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
+var errNegativeOffset = errors.New("negative offset")
+
+// chainReader maps offsets within a file through its chain of blocks, with
+// the directory entry presented first.
+type chainReader struct {
+	mc     *memoryCard
+	header []byte
+	blocks []uint16
+}
+
+func (cr *chainReader) size() int64 {
+	return int64(len(cr.header)) + int64(len(cr.blocks))*blockSize
+}
+
+func (cr *chainReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+
+	n := 0
+
+	for len(p) > 0 {
+		if off < int64(len(cr.header)) {
+			m := copy(p, cr.header[off:])
+			n, off, p = n+m, off+int64(m), p[m:]
+
+			continue
+		}
+
+		i, o := (off-int64(len(cr.header)))/blockSize, (off-int64(len(cr.header)))%blockSize
+		if i >= int64(len(cr.blocks)) {
+			return n, io.EOF
+		}
+
+		chunk := p
+		if int64(len(chunk)) > blockSize-o {
+			chunk = chunk[:blockSize-o]
+		}
+
+		m, err := cr.mc.blockReader(int(cr.blocks[i]-reservedBlocks)).ReadAt(chunk, o)
+		n, off, p = n+m, off+int64(m), p[m:]
+
+		if m < len(chunk) {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
 type fileReader struct {
-	io.ReadCloser
+	*io.SectionReader
 	f *File
 }
 
 func (fr *fileReader) Stat() (fs.FileInfo, error) {
-	return headerFileInfo{&fr.f.FileHeader}, nil
+	return headerFileInfo{&fr.f.FileHeader, fr.f.fsName, fr.Size()}, nil
+}
+
+func (fr *fileReader) Close() error {
+	return nil
 }
 
 // A File is a single file within a memory card.
 type File struct {
 	FileHeader
-	GameCode  string
-	MakerCode string
-
-	r *Reader
-	e *entry
+	GameCode        string
+	MakerCode       string
+	BannerFormat    BannerFormat
+	IconGfxFormat   IconFormat
+	AnimationSpeed  AnimationSpeed
+	Permissions     Permission
+	CopyCounter     uint8
+	FirstBlock      uint16 // First block of the file data
+	FileLength      uint16 // Length of the file data in blocks
+	ImageDataOffset uint32 // Offset of the banner and icon within the file data
+	CommentAddress  uint32 // Offset of the comments within the file data
+	Slot            int    // Index of the directory entry
+
+	r    *Reader
+	e    *entry
+	d, m int // Directory and block map copies describing the file
 }
 
 // Open returns an fs.File that provides access to the File's contents. The
 // file is prefixed with a 64 byte header (the directory entry) followed by one
-// or more 8 KiB blocks. Multiple files may be read concurrently.
+// or more 8 KiB blocks. The returned fs.File also implements io.ReaderAt and
+// io.Seeker. Multiple files may be read concurrently.
 func (f *File) Open() (fs.File, error) {
-	m := f.r.mc.activeBlockMap()
+	b, err := f.e.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
 
-	blocks := make([]int, 0, f.e.FileLength)
-	blocks = append(blocks, int(f.e.FirstBlock-reservedBlocks))
+	return f.open(b)
+}
 
-	for i := blocks[0]; f.r.mc.blockMap[m].Blocks[i] != 0xffff; i = int(f.r.mc.blockMap[m].Blocks[i]) - reservedBlocks {
-		blocks = append(blocks, int(f.r.mc.blockMap[m].Blocks[i])-reservedBlocks)
+// OpenData returns an fs.File that provides access to just the data blocks of
+// the File's contents, without the directory entry that Open includes. The
+// directory entry is described by the fields of the File instead. As with
+// Open, the returned fs.File also implements io.ReaderAt and io.Seeker.
+func (f *File) OpenData() (fs.File, error) {
+	return f.open(nil)
+}
+
+func (f *File) open(header []byte) (fs.File, error) {
+	blocks, err := f.blocks()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: f.Name, Err: err}
 	}
 
-	readers := make([]io.Reader, 0, len(blocks)+1)
+	cr := &chainReader{f.r.mc, header, blocks}
 
-	b, err := f.e.MarshalBinary()
+	return &fileReader{io.NewSectionReader(cr, 0, cr.size()), f}, nil
+}
+
+// dataSize returns the size of the file data, without the directory entry.
+func (f *File) dataSize() int64 {
+	return int64(f.e.FileLength) * blockSize
+}
+
+// blocks returns the chain of blocks holding the file data.
+func (f *File) blocks() ([]uint16, error) {
+	mc := f.r.mc
+
+	blocks, err := mc.blockMap[f.m].chain(f.e.FirstBlock, mc.header.blocks())
 	if err != nil {
-		return nil, err
+		return nil, mc.chainError(f.d, f.m, f.Slot, blocks, err)
+	}
+
+	if len(blocks) != int(f.e.FileLength) {
+		return nil, newCorruptionError(StructureDirectory, f.d, f.Slot, entryOffset(f.Slot, entryFileLengthOffset),
+			ErrFileLengthMismatch)
+	}
+
+	return blocks, nil
+}
+
+// readAt fills p from the file data at offset off. If that lies beyond the end
+// of the file then the problem is blamed on the directory entry field at the
+// given offset.
+func (f *File) readAt(p []byte, off uint32, field int, errOutOfRange error) error {
+	blocks, err := f.blocks()
+	if err != nil {
+		return err
+	}
+
+	if int64(off)+int64(len(p)) > int64(len(blocks))*blockSize {
+		return newCorruptionError(StructureDirectory, f.d, f.Slot, entryOffset(f.Slot, field), errOutOfRange)
 	}
 
-	readers = append(readers, bytes.NewReader(b))
+	cr := &chainReader{mc: f.r.mc, blocks: blocks}
+	if _, err := cr.ReadAt(p, int64(off)); err != nil {
+		return fmt.Errorf("unable to read: %w", err)
+	}
 
-	for _, block := range blocks {
-		readers = append(readers, bytes.NewReader(f.r.mc.blocks[block][:]))
+	return nil
+}
+
+// Comment returns the two comment strings stored within the file data, which
+// the IPL displays as the title and description of the save. They are decoded
+// according to the memory card encoding.
+func (f *File) Comment() (string, string, error) {
+	if f.CommentAddress == noOffset {
+		return "", "", nil
 	}
 
-	return &fileReader{io.NopCloser(io.MultiReader(readers...)), f}, nil
+	b := make([]byte, commentSize)
+
+	if err := f.readAt(b, f.CommentAddress, entryCommentAddressOffset, ErrCommentAddressOutOfRange); err != nil {
+		return "", "", err
+	}
+
+	encoding := f.r.mc.header.Encoding
+
+	return DecodeString(encoding, b[:commentSize/2]), DecodeString(encoding, b[commentSize/2:]), nil
 }
 
 // FileHeader describes a file within a memory card.
@@ -67,11 +197,19 @@ type FileHeader struct {
 	Name     string
 	Modified time.Time
 	Size     int64
+
+	fsName string // Escaped name used within the fs.FS
 }
 
-// FileInfo returns an fs.FileInfo for the FileHeader.
+// FileInfo returns an fs.FileInfo for the FileHeader. For a file read from a
+// memory card the name is escaped as with EscapeName.
 func (h *FileHeader) FileInfo() fs.FileInfo {
-	return headerFileInfo{h}
+	name := h.fsName
+	if name == "" {
+		name = path.Base(h.Name)
+	}
+
+	return headerFileInfo{h, name, h.Size}
 }
 
 // Mode returns the permission and mode bits for the FileHeader.
@@ -80,11 +218,13 @@ func (h *FileHeader) Mode() fs.FileMode {
 }
 
 type headerFileInfo struct {
-	fh *FileHeader
+	fh   *FileHeader
+	name string
+	size int64
 }
 
-func (fi headerFileInfo) Name() string               { return path.Base(fi.fh.Name) }
-func (fi headerFileInfo) Size() int64                { return fi.fh.Size }
+func (fi headerFileInfo) Name() string               { return fi.name }
+func (fi headerFileInfo) Size() int64                { return fi.size }
 func (fi headerFileInfo) IsDir() bool                { return fi.Mode().IsDir() }
 func (fi headerFileInfo) ModTime() time.Time         { return fi.fh.Modified.UTC() }
 func (fi headerFileInfo) Mode() fs.FileMode          { return fi.fh.Mode() }
@@ -93,10 +233,11 @@ func (fi headerFileInfo) Sys() interface{}           { return fi.fh }
 func (fi headerFileInfo) Info() (fs.FileInfo, error) { return fi, nil }
 
 type fileListEntry struct {
-	name  string
-	file  *File
-	isDir bool
-	isDup bool
+	name     string
+	file     *File
+	isDir    bool
+	isDup    bool
+	modified time.Time
 }
 
 type fileInfoDirEntry interface {
@@ -110,7 +251,12 @@ func (e *fileListEntry) stat() (fileInfoDirEntry, error) { //nolint:ireturn
 	}
 
 	if !e.isDir {
-		return headerFileInfo{&e.file.FileHeader}, nil
+		size := e.file.Size
+		if e.file.r.dataOnly {
+			size = e.file.dataSize()
+		}
+
+		return headerFileInfo{&e.file.FileHeader, e.Name(), size}, nil
 	}
 
 	return e, nil
@@ -130,7 +276,7 @@ func (e *fileListEntry) Sys() interface{}  { return nil }
 
 func (e *fileListEntry) ModTime() time.Time {
 	if e.file == nil {
-		return time.Time{}
+		return e.modified.UTC()
 	}
 
 	return e.file.FileHeader.Modified.UTC()
@@ -148,21 +294,84 @@ type Reader struct {
 	CardSize uint16
 	Encoding uint16
 
+	// FormatTime is when the memory card was formatted.
+	FormatTime time.Time
+	// CounterBias is the real-time clock bias of the console that
+	// formatted the memory card.
+	CounterBias uint32
+	// Language is the language the IPL was set to when the memory card
+	// was formatted.
+	Language Language
+	// Unknown is a header field of unknown purpose, it seems to be either
+	// 0 or 1.
+	Unknown uint32
+	// DeviceID is the device ID stored in the header.
+	DeviceID uint16
+	// UpdateCounter is the update counter stored in the header.
+	UpdateCounter uint16
+
+	// Skipped lists the damaged structures that were ignored when the
+	// memory card image was opened with the Lenient option.
+	Skipped []error
+
+	lenient     bool
+	groupByGame bool
+	dataOnly    bool
+
 	fileListOnce sync.Once
 	fileList     []fileListEntry
+	dot          fileListEntry
 }
 
-func (r *Reader) init(nr io.Reader) error {
+func (r *Reader) init(nr io.Reader, options ...func(*Reader) error) error {
+	if err := r.setOption(options...); err != nil {
+		return err
+	}
+
 	r.mc = new(memoryCard)
 
 	if err := r.mc.unmarshalBinary(nr); err != nil {
 		return err
 	}
 
+	return r.load()
+}
+
+func (r *Reader) initAt(ra io.ReaderAt, size int64, options ...func(*Reader) error) error {
+	if err := r.setOption(options...); err != nil {
+		return err
+	}
+
+	r.mc = new(memoryCard)
+
+	if err := r.mc.unmarshalBinaryAt(ra, size); err != nil {
+		return err
+	}
+
+	return r.load()
+}
+
+func (r *Reader) load() error {
+	if r.lenient {
+		skipped, err := r.mc.salvage()
+		if err != nil {
+			return err
+		}
+
+		r.Skipped = skipped
+	} else if err := r.mc.isValid(); err != nil {
+		return err
+	}
+
 	r.FlashID = extractFlashID(r.mc.header.Serial, r.mc.header.FormatTime)
 
 	r.CardSize, r.Encoding = r.mc.header.CardSize, r.mc.header.Encoding
 
+	h := &r.mc.header
+	r.FormatTime = ticksToTime(h.FormatTime)
+	r.CounterBias, r.Language, r.Unknown = h.CounterBias, h.Lang, binary.BigEndian.Uint32(h.Unknown[:])
+	r.DeviceID, r.UpdateCounter = h.DeviceID, h.UpdateCounter
+
 	r.File = make([]*File, 0, r.mc.count())
 
 	for i := range r.mc.directory[r.mc.activeDirectory()].Entries {
@@ -172,25 +381,64 @@ func (r *Reader) init(nr io.Reader) error {
 			continue
 		}
 
-		f := &File{e: &e, r: r}
-		f.Name = e.filename()
-		f.Modified = e.lastModified()
-		f.Size = int64(binary.Size(e) + int(e.FileLength)*blockSize)
-		f.GameCode = e.gameCode()
-		f.MakerCode = e.makerCode()
-
-		r.File = append(r.File, f)
+		r.File = append(r.File, r.newFile(e, i, r.mc.activeDirectory(), r.mc.activeBlockMap()))
 	}
 
 	return nil
 }
 
+func (r *Reader) newFile(e entry, slot, d, m int) *File {
+	f := &File{e: &e, r: r, d: d, m: m}
+	f.Name = e.name(r.mc.header.Encoding)
+	f.fsName = r.mc.fsName(&e, false)
+	f.Modified = e.lastModified()
+	f.Size = int64(binary.Size(e) + int(e.FileLength)*blockSize)
+	f.GameCode = e.gameCode()
+	f.MakerCode = e.makerCode()
+	f.BannerFormat = e.BannerFormat
+	f.IconGfxFormat = e.IconGfxFormat
+	f.AnimationSpeed = e.AnimationSpeed
+	f.Permissions = e.Permissions
+	f.CopyCounter = e.CopyCounter
+	f.FirstBlock = e.FirstBlock
+	f.FileLength = e.FileLength
+	f.ImageDataOffset = e.ImageDataOffset
+	f.CommentAddress = e.CommentAddress
+	f.Slot = slot
+
+	return f
+}
+
+// SerialNumbers returns the two serial numbers derived from the memory card
+// header. Some games store these in their save files to bind them to the
+// memory card they were created on.
+func (r *Reader) SerialNumbers() (uint32, uint32) {
+	return r.mc.serialNumbers()
+}
+
 func (r *Reader) initFileList() {
 	r.fileListOnce.Do(func() {
 		files := make(map[string]int)
+		dirs := make(map[string]time.Time)
+
+		// The root directory was last modified when the most recent file
+		// was, or when the card was formatted if it's empty
+		r.dot = fileListEntry{name: "./", isDir: true, modified: r.FormatTime}
 
 		for _, file := range r.File {
-			name := file.Name
+			name := r.mc.fsName(file.e, r.groupByGame)
+
+			if file.Modified.After(r.dot.modified) {
+				r.dot.modified = file.Modified
+			}
+
+			if r.groupByGame {
+				dir, _ := split(name)
+
+				if modified, ok := dirs[dir]; !ok || file.Modified.After(modified) {
+					dirs[dir] = file.Modified
+				}
+			}
 
 			if idx, ok := files[name]; ok {
 				r.fileList[idx].isDup = true
@@ -208,6 +456,14 @@ func (r *Reader) initFileList() {
 			files[name] = idx
 		}
 
+		for dir, modified := range dirs {
+			r.fileList = append(r.fileList, fileListEntry{
+				name:     dir + "/",
+				isDir:    true,
+				modified: modified,
+			})
+		}
+
 		sort.Slice(r.fileList, func(i, j int) bool { return fileEntryLess(r.fileList[i].name, r.fileList[j].name) })
 	})
 }
@@ -236,12 +492,9 @@ func split(name string) (string, string) {
 	return name[:i], name[i+1:]
 }
 
-//nolint:gochecknoglobals
-var dotFile = &fileListEntry{name: "./", isDir: true}
-
 func (r *Reader) openLookup(name string) *fileListEntry {
 	if name == "." {
-		return dotFile
+		return &r.dot
 	}
 
 	dir, elem := split(name)
@@ -325,7 +578,8 @@ func (d *openDir) ReadDir(count int) ([]fs.DirEntry, error) {
 
 // Open opens the named file in the memory card image, using the semantics of
 // fs.FS.Open: paths are always slash separated, with no leading / or ../
-// elements.
+// elements. Filenames are escaped with EscapeName so that every file can be
+// reached.
 func (r *Reader) Open(name string) (fs.File, error) {
 	r.initFileList()
 
@@ -342,7 +596,126 @@ func (r *Reader) Open(name string) (fs.File, error) {
 		return &openDir{e, r.openReadDir(name), 0}, nil
 	}
 
-	return e.file.Open()
+	return r.openFile(e.file)
+}
+
+// ReadDir reads the named directory in the memory card image and returns a
+// list of directory entries sorted by filename, using the semantics of
+// fs.ReadDirFS.ReadDir.
+func (r *Reader) ReadDir(name string) ([]fs.DirEntry, error) {
+	r.initFileList()
+
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	e := r.openLookup(name)
+	if e == nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if !e.isDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")} //nolint:goerr113
+	}
+
+	d := &openDir{e, r.openReadDir(name), 0}
+
+	return d.ReadDir(-1)
+}
+
+// ReadFile reads the named file in the memory card image and returns its
+// contents, using the semantics of fs.ReadFileFS.ReadFile.
+func (r *Reader) ReadFile(name string) ([]byte, error) {
+	r.initFileList()
+
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+
+	e := r.openLookup(name)
+	if e == nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if e.isDir {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")} //nolint:goerr113
+	}
+
+	f, err := r.openFile(e.file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	b := make([]byte, fi.Size())
+	if _, err := io.ReadFull(f, b); err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+
+	return b, nil
+}
+
+// Stat returns an fs.FileInfo describing the named file in the memory card
+// image, using the semantics of fs.StatFS.Stat.
+func (r *Reader) Stat(name string) (fs.FileInfo, error) {
+	r.initFileList()
+
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	e := r.openLookup(name)
+	if e == nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return e.stat()
+}
+
+// Glob returns the names of all files in the memory card image matching
+// pattern, using the semantics of fs.GlobFS.Glob.
+func (r *Reader) Glob(pattern string) ([]string, error) {
+	r.initFileList()
+
+	// Check the pattern is well-formed
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if !strings.ContainsAny(pattern, `*?[\`) {
+		if _, err := r.Stat(pattern); err != nil {
+			return nil, nil
+		}
+
+		return []string{pattern}, nil
+	}
+
+	var matches []string
+
+	for i := range r.fileList {
+		name := strings.TrimSuffix(r.fileList[i].name, "/")
+
+		if ok, _ := path.Match(pattern, name); ok {
+			matches = append(matches, name)
+		}
+	}
+
+	sort.Strings(matches)
+
+	return matches, nil
+}
+
+func (r *Reader) openFile(f *File) (fs.File, error) {
+	if r.dataOnly {
+		return f.OpenData()
+	}
+
+	return f.Open()
 }
 
 // A ReadCloser is a Reader that must be closed when no longer needed.
@@ -361,9 +734,22 @@ func (rc *ReadCloser) Close() error {
 }
 
 // NewReader returns a new Reader reading from r.
-func NewReader(r io.Reader) (*Reader, error) {
+func NewReader(r io.Reader, options ...func(*Reader) error) (*Reader, error) {
+	mcr := new(Reader)
+	if err := mcr.init(r, options...); err != nil {
+		return nil, err
+	}
+
+	return mcr, nil
+}
+
+// NewReaderAt returns a new Reader reading from r, which is assumed to have
+// the given size in bytes. Only the header, directory and block allocation
+// map are read up front, the data blocks are read from r on demand so r must
+// remain valid for as long as the Reader is used.
+func NewReaderAt(r io.ReaderAt, size int64, options ...func(*Reader) error) (*Reader, error) {
 	mcr := new(Reader)
-	if err := mcr.init(r); err != nil {
+	if err := mcr.initAt(r, size, options...); err != nil {
 		return nil, err
 	}
 
@@ -371,15 +757,22 @@ func NewReader(r io.Reader) (*Reader, error) {
 }
 
 // OpenReader will open the memory card image specified by name and return a
-// ReadCloser.
-func OpenReader(name string) (*ReadCloser, error) {
+// ReadCloser. As with NewReaderAt, the data blocks are read on demand.
+func OpenReader(name string, options ...func(*Reader) error) (*ReadCloser, error) {
 	f, err := os.Open(name)
 	if err != nil {
 		return nil, fmt.Errorf("unable to open: %w", err)
 	}
 
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+
+		return nil, fmt.Errorf("unable to stat: %w", err)
+	}
+
 	r := new(ReadCloser)
-	if err := r.init(f); err != nil {
+	if err := r.initAt(f, fi.Size(), options...); err != nil {
 		f.Close()
 
 		return nil, err
@@ -389,3 +782,50 @@ func OpenReader(name string) (*ReadCloser, error) {
 
 	return r, nil
 }
+
+func (r *Reader) setOption(options ...func(*Reader) error) error {
+	for _, option := range options {
+		if err := option(r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Lenient relaxes the validation performed when opening a memory card image.
+// Rather than rejecting the image if any structure is damaged, each copy of
+// the directory and block allocation map is checked on its own and a damaged
+// copy is skipped in favour of the good one, even if the good copy is older.
+// A bad header checksum is also tolerated. Anything skipped is recorded in
+// Reader.Skipped.
+func Lenient() func(*Reader) error {
+	return func(r *Reader) error {
+		r.lenient = true
+
+		return nil
+	}
+}
+
+// GroupByGame lays out the file system presented by the Reader with each file
+// in a directory named after its game and maker codes, for example
+// GALE01/SuperSmashBros0110290334, rather than all at the root. This allows
+// different games to use the same filename.
+func GroupByGame() func(*Reader) error {
+	return func(r *Reader) error {
+		r.groupByGame = true
+
+		return nil
+	}
+}
+
+// DataOnly changes the file system presented by the Reader so that each file
+// contains just its data blocks, as returned by File.OpenData, rather than
+// being in GCI format with the directory entry first.
+func DataOnly() func(*Reader) error {
+	return func(r *Reader) error {
+		r.dataOnly = true
+
+		return nil
+	}
+}
@@ -0,0 +1,376 @@
+package gc
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	fuzzDirectorySize  = 8 * 0x40
+	fuzzBlockMapOffset = 0x06
+	fuzzBlockMapSize   = 0x80
+)
+
+func readAll(t *testing.T, r *Reader) {
+	t.Helper()
+
+	_ = r.Verify()
+
+	for _, f := range r.File {
+		fr, err := f.Open()
+		if err != nil {
+			continue
+		}
+
+		_, _ = io.Copy(io.Discard, fr)
+		_ = fr.Close()
+
+		_, _ = f.Banner()
+		_, _ = f.Icon()
+		_, _, _ = f.Comment()
+	}
+}
+
+func FuzzNewReader(f *testing.F) {
+	for _, file := range []string{"0251b_2020_04Apr_01_05-02-47.raw", "blank.mcd", "patches.raw"} {
+		b, err := os.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			f.Fatal(err)
+		}
+
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, options := range [][]func(*Reader) error{nil, {Lenient()}} {
+			if r, err := NewReader(bytes.NewReader(b), options...); err == nil {
+				readAll(t, r)
+			}
+
+			if r, err := NewReaderAt(bytes.NewReader(b), int64(len(b)), options...); err == nil {
+				readAll(t, r)
+			}
+		}
+	})
+}
+
+// fuzzSeeds returns the memory card image used for fuzzing, which has a
+// deleted file so the two copies of the directory and block allocation map
+// differ, along with seeds to mutate it with, see fuzzImage.
+func fuzzSeeds(tb testing.TB) ([]byte, [][]byte) {
+	tb.Helper()
+
+	b, err := os.ReadFile(filepath.Join("testdata", "patches.raw"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	mc := new(memoryCard)
+	if err := mc.unmarshalBinary(bytes.NewReader(b)); err != nil {
+		tb.Fatal(err)
+	}
+
+	if err := mc.removeFile(2); err != nil {
+		tb.Fatal(err)
+	}
+
+	image, err := mc.MarshalBinary()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	copyOf := func(i int) []byte {
+		offset := (3+i)*blockSize + fuzzBlockMapOffset
+
+		seed := make([]byte, 0, fuzzDirectorySize+fuzzBlockMapSize)
+		seed = append(seed, image[(1+i)*blockSize:(1+i)*blockSize+fuzzDirectorySize]...)
+
+		return append(seed, image[offset:offset+fuzzBlockMapSize]...)
+	}
+
+	return image, [][]byte{copyOf(master), append(copyOf(master), copyOf(backup)...)}
+}
+
+// fuzzImage mutates the start of both directory copies and both block
+// allocation maps of image, (leaving the update counters alone), and then
+// fixes up the checksums so the mutations aren't rejected before any blocks
+// are followed. If b is long enough then each copy is mutated differently.
+func fuzzImage(tb testing.TB, image, b []byte) []byte {
+	tb.Helper()
+
+	buf := make([]byte, len(image))
+	copy(buf, image)
+
+	const size = fuzzDirectorySize + fuzzBlockMapSize
+
+	for i := 0; i < copies; i++ {
+		src := b
+		if len(b) >= copies*size {
+			src = b[i*size:]
+		}
+
+		copy(buf[(1+i)*blockSize:(1+i)*blockSize+fuzzDirectorySize], src)
+
+		if len(src) > fuzzDirectorySize {
+			offset := (3+i)*blockSize + fuzzBlockMapOffset
+			copy(buf[offset:offset+fuzzBlockMapSize], src[fuzzDirectorySize:])
+		}
+	}
+
+	mc := new(memoryCard)
+	if err := mc.unmarshalBinary(bytes.NewReader(buf)); err != nil {
+		tb.Fatal(err)
+	}
+
+	for i := 0; i < copies; i++ {
+		_ = mc.directory[i].checksum()
+		_ = mc.blockMap[i].checksum()
+	}
+
+	buf, err := mc.MarshalBinary()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return buf
+}
+
+// FuzzFileOpen reads every file from a mutated image, along with any deleted
+// files, and verifies it.
+func FuzzFileOpen(f *testing.F) {
+	image, seeds := fuzzSeeds(f)
+
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		fileOpen(t, fuzzImage(t, image, b))
+	})
+}
+
+// fileOpen reads every file from the image in buf, along with any deleted
+// files, and verifies and repairs it.
+func fileOpen(t *testing.T, buf []byte) {
+	t.Helper()
+
+	for _, options := range [][]func(*Reader) error{nil, {Lenient()}} {
+		r, err := NewReader(bytes.NewReader(buf), options...)
+		if err != nil {
+			continue
+		}
+
+		readAll(t, r)
+
+		for _, df := range r.Deleted() {
+			if fr, err := df.Open(); err == nil {
+				_, _ = io.Copy(io.Discard, fr)
+				_ = fr.Close()
+			}
+		}
+	}
+
+	_, _ = Verify(bytes.NewReader(buf), int64(len(buf)))
+	_, _ = Repair(bytes.NewReader(buf), int64(len(buf)), io.Discard)
+}
+
+// FuzzEditor edits a mutated image in every way possible.
+func FuzzEditor(f *testing.F) {
+	image, seeds := fuzzSeeds(f)
+
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		edit(t, fuzzImage(t, image, b))
+	})
+}
+
+// edit makes every kind of change to the image in buf with an Editor.
+func edit(t *testing.T, buf []byte) {
+	t.Helper()
+
+	r, err := NewReader(bytes.NewReader(buf), Lenient())
+	if err != nil {
+		return
+	}
+
+	e, err := NewEditor(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		return
+	}
+
+	for i, file := range r.File {
+		switch i % 3 {
+		case 0:
+			if gci, err := r.ReadFile(file.fsName); err == nil {
+				if w, err := e.Replace(file.fsName); err == nil {
+					_, _ = w.Write(gci)
+					_ = w.Close()
+				}
+			}
+		case 1:
+			_ = e.Remove(file.fsName)
+		case 2:
+			_ = e.Rename(file.fsName, "renamed")
+		}
+	}
+
+	_ = e.Copy(r.File, CopyForce)
+	_ = e.Defragment(OrderGameCode)
+
+	wa := &fuzzWriterAt{b: append([]byte{}, buf...)}
+	if err := e.SaveAt(wa); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := new(bytes.Buffer)
+	if err := e.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, saved.Bytes(), wa.b)
+
+	// Editing a good image never damages it
+	if r.Verify().OK() {
+		report, err := Verify(bytes.NewReader(saved.Bytes()), int64(saved.Len()))
+		if assert.NoError(t, err) {
+			assert.Empty(t, report.Problems)
+		}
+	}
+}
+
+type fuzzWriterAt struct {
+	b []byte
+}
+
+func (w *fuzzWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	return copy(w.b[off:], p), nil
+}
+
+func TestOpenBrokenChain(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name   string
+		modify func(*directory, *blockMap)
+		err    error
+	}{
+		{
+			name: "first block out of range",
+			modify: func(d *directory, _ *blockMap) {
+				d.Entries[0].FirstBlock = 0x1000
+			},
+			err: ErrBlockOutOfRange,
+		},
+		{
+			name: "reserved block",
+			modify: func(_ *directory, m *blockMap) {
+				m.Blocks[0] = 2
+			},
+			err: ErrBlockOutOfRange,
+		},
+		{
+			name: "loop",
+			modify: func(_ *directory, m *blockMap) {
+				m.Blocks[1] = reservedBlocks
+			},
+			err: ErrBlockChainLoop,
+		},
+		{
+			name: "short chain",
+			modify: func(_ *directory, m *blockMap) {
+				m.Blocks[0] = lastBlock
+			},
+			err: ErrFileLengthMismatch,
+		},
+	}
+
+	image, err := os.ReadFile(filepath.Join("testdata", "patches.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.name, func(t *testing.T) {
+			t.Parallel()
+
+			mc := new(memoryCard)
+			if err := mc.UnmarshalBinary(image); err != nil {
+				t.Fatal(err)
+			}
+
+			d, m := &mc.directory[mc.activeDirectory()], &mc.blockMap[mc.activeBlockMap()]
+			table.modify(d, m)
+
+			_ = d.checksum()
+			_ = m.checksum()
+
+			b, err := mc.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := NewReader(bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = r.File[0].Open()
+			assert.ErrorIs(t, err, table.err)
+		})
+	}
+}
+
+func TestBannerUnknownFormat(t *testing.T) {
+	t.Parallel()
+
+	mc, err := newMemoryCard([12]byte{}, 0, MemoryCard59, EncodingANSI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := SaveHeader{
+		GameCode:        "GTST",
+		MakerCode:       "01",
+		Name:            "a",
+		BannerFormat:    BannerCI8 | BannerRGB5A3,
+		Size:            blockSize,
+		ImageDataOffset: 0,
+		CommentAddress:  noOffset,
+	}
+
+	e, err := h.entry(EncodingANSI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mc.addFile(0, e, bytes.NewReader(make([]byte, h.Size)), false); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := mc.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing the exported field has no effect
+	f := r.File[0]
+	f.BannerFormat = BannerRGB5A3
+
+	img, err := f.Banner()
+	assert.Nil(t, img)
+	assert.NoError(t, err)
+}
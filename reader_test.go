@@ -1,23 +1,610 @@
 package gc_test
 
 import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"io/fs"
+	"os"
+	"path"
 	"path/filepath"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/bodgit/gc"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestFS(t *testing.T) {
 	t.Parallel()
 
+	tables := []struct {
+		file string
+	}{
+		{"0251b_2020_04Apr_01_05-02-47.raw"},
+		{"blank.mcd"},
+		{"patches.raw"},
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.file, func(t *testing.T) {
+			t.Parallel()
+
+			rc, err := gc.OpenReader(filepath.Join("testdata", table.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+
+			expected := make([]string, 0, len(rc.File))
+			for _, f := range rc.File {
+				expected = append(expected, f.Name)
+			}
+
+			if err := fstest.TestFS(rc, expected...); err != nil {
+				t.Fatal(err)
+			}
+
+			fi, err := fs.Stat(rc, ".")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.True(t, fi.IsDir())
+			assert.False(t, fi.ModTime().IsZero())
+		})
+	}
+}
+
+func TestFSMethods(t *testing.T) {
+	t.Parallel()
+
+	rc, err := gc.OpenReader(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	entries, err := rc.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, entries, len(rc.File))
+	assert.Equal(t, "MetroidPrime", entries[0].Name())
+
+	b, err := rc.ReadFile("fzc.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, rc.File[3].Size, int64(len(b)))
+
+	_, err = rc.ReadFile(".")
+	assert.Error(t, err)
+
+	_, err = rc.ReadDir("fzc.dat")
+	assert.Error(t, err)
+
+	_, err = rc.Stat("missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	matches, err := rc.Glob("Metroid*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"MetroidPrime", "MetroidPrime2"}, matches)
+
+	_, err = rc.Glob("[")
+	assert.ErrorIs(t, err, path.ErrBadPattern)
+
+	// The root directory was last modified with the newest file
+	var newest time.Time
+
+	for _, f := range rc.File {
+		if f.Modified.After(newest) {
+			newest = f.Modified
+		}
+	}
+
+	fi, err := rc.Stat(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, newest.Equal(fi.ModTime()))
+}
+
+func TestGroupByGame(t *testing.T) {
+	t.Parallel()
+
+	rc, err := gc.OpenReader(filepath.Join("testdata", "patches.raw"), gc.GroupByGame())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	expected := make([]string, 0, len(rc.File))
+	for _, f := range rc.File {
+		expected = append(expected, f.GameCode+f.MakerCode+"/"+f.Name)
+	}
+
+	if err := fstest.TestFS(rc, expected...); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := rc.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		assert.True(t, e.IsDir())
+		names = append(names, e.Name())
+	}
+
+	assert.Equal(t, []string{"GFZP8P", "GPOP8P", "GPSP8P"}, names)
+
+	matches, err := rc.Glob("*/PSO*_SYSTEM")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"GPOP8P/PSO_SYSTEM", "GPSP8P/PSO3_SYSTEM"}, matches)
+
+	fi, err := rc.Stat("GPOP8P/PSO_GUILDCARD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "PSO_GUILDCARD", fi.Name())
+}
+
+func TestDataOnly(t *testing.T) {
+	t.Parallel()
+
+	rc, err := gc.OpenReader(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	gci, err := rc.ReadFile("fzc.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := rc.File[3].OpenData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, int64(rc.File[3].FileLength)*0x2000, fi.Size())
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, gci[0x40:], data)
+
+	do, err := gc.OpenReader(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"), gc.DataOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer do.Close()
+
+	expected := make([]string, 0, len(do.File))
+	for _, f := range do.File {
+		expected = append(expected, f.Name)
+	}
+
+	if err := fstest.TestFS(do, expected...); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := do.ReadFile("fzc.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, data, b)
+
+	fi, err = do.Stat("fzc.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, int64(len(data)), fi.Size())
+}
+
+func TestLenient(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name    string
+		offsets []int
+		skipped int
+		err     bool
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name:    "backup directory",
+			offsets: []int{0x4020},
+			skipped: 1,
+		},
+		{
+			name:    "both block maps",
+			offsets: []int{0x6010, 0x8010},
+			skipped: 2,
+			err:     true,
+		},
+		{
+			name:    "header and master block map",
+			offsets: []int{0x0010, 0x6010},
+			skipped: 2,
+		},
+	}
+
+	b, err := os.ReadFile(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.name, func(t *testing.T) {
+			t.Parallel()
+
+			image := make([]byte, len(b))
+			copy(image, b)
+
+			for _, offset := range table.offsets {
+				image[offset] ^= 0xff
+			}
+
+			if _, err := gc.NewReader(bytes.NewReader(image)); len(table.offsets) > 0 {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+
+			r, err := gc.NewReader(bytes.NewReader(image), gc.Lenient())
+			if table.err {
+				assert.NotNil(t, err)
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Len(t, r.Skipped, table.skipped)
+			assert.Len(t, r.File, 7)
+		})
+	}
+}
+
+func TestNewReaderAt(t *testing.T) {
+	t.Parallel()
+
+	b, err := os.ReadFile(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := gc.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ra, err := gc.NewReaderAt(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !assert.Len(t, ra.File, len(r.File)) {
+		return
+	}
+
+	for i, f := range r.File {
+		expected, err := fs.ReadFile(r, f.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := fs.ReadFile(ra, ra.File[i].Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, expected, actual)
+	}
+
+	_, err = gc.NewReaderAt(bytes.NewReader(b), int64(len(b))-1)
+	assert.NotNil(t, err)
+}
+
+func TestFileReadAt(t *testing.T) {
+	t.Parallel()
+
+	rc, err := gc.OpenReader(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	expected, err := fs.ReadFile(rc, "gczelda")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := rc.Open("gczelda")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ra, ok := f.(io.ReaderAt)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	for _, offset := range []int64{0, 0x30, 0x2000, 0x2040, 0x3ff0, int64(len(expected)) - 0x100} {
+		b := make([]byte, 0x100)
+
+		n, err := ra.ReadAt(b, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, expected[offset:offset+int64(n)], b)
+	}
+
+	n, err := ra.ReadAt(make([]byte, 0x100), int64(len(expected))-0x10)
+	assert.Equal(t, 0x10, n)
+	assert.ErrorIs(t, err, io.EOF)
+
+	s, ok := f.(io.Seeker)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	if _, err := s.Seek(0x2040, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, expected[0x2040:], b)
+}
+
+func TestFileMetadata(t *testing.T) {
+	t.Parallel()
+
 	rc, err := gc.OpenReader(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer rc.Close()
 
-	if err := fstest.TestFS(rc, "fzc.dat", "gc4sword"); err != nil {
+	f := rc.File[0]
+
+	assert.Equal(t, "Star Fox Adventures", f.Name)
+	assert.Equal(t, gc.BannerRGB5A3, f.BannerFormat.Format())
+	assert.True(t, f.BannerFormat.PingPong())
+	assert.Equal(t, gc.IconCI8Shared, f.IconGfxFormat.Frame(3))
+	assert.Equal(t, gc.IconNone, f.IconGfxFormat.Frame(4))
+	assert.Equal(t, gc.Speed12, f.AnimationSpeed.Frame(3))
+	assert.Equal(t, gc.SpeedNone, f.AnimationSpeed.Frame(4))
+	assert.Equal(t, gc.PermissionPublic, f.Permissions)
+	assert.Equal(t, uint8(1), f.CopyCounter)
+	assert.Equal(t, uint16(5), f.FirstBlock)
+	assert.Equal(t, uint16(3), f.FileLength)
+	assert.Equal(t, uint32(0x40), f.ImageDataOffset)
+	assert.Equal(t, uint32(0), f.CommentAddress)
+	assert.Equal(t, 0, f.Slot)
+}
+
+func TestComment(t *testing.T) {
+	t.Parallel()
+
+	rc, err := gc.OpenReader(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
 		t.Fatal(err)
 	}
+	defer rc.Close()
+
+	tables := []struct {
+		file        int
+		title       string
+		description string
+	}{
+		{0, "Star Fox Adventures", "Dinosaur Planet"},
+		{2, "Zelda: The Wind Waker", "10/31 Save Data"},
+		{3, "F-ZERO GX", "03/11/02 13:54"},
+	}
+
+	for _, table := range tables {
+		title, description, err := rc.File[table.file].Comment()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, table.title, title)
+		assert.Equal(t, table.description, description)
+	}
+}
+
+func TestBanner(t *testing.T) {
+	t.Parallel()
+
+	rc, err := gc.OpenReader(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	for _, f := range rc.File {
+		img, err := f.Banner()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch f.BannerFormat.Format() {
+		case gc.BannerCI8:
+			assert.IsType(t, new(image.Paletted), img)
+		case gc.BannerRGB5A3:
+			assert.IsType(t, new(image.NRGBA), img)
+		}
+
+		assert.Equal(t, image.Rect(0, 0, 96, 32), img.Bounds())
+	}
+}
+
+func TestIcon(t *testing.T) {
+	t.Parallel()
+
+	rc, err := gc.OpenReader(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	tables := []struct {
+		file     int
+		frames   int
+		delay    time.Duration
+		pingPong bool
+		gif      int
+	}{
+		{0, 4, 200 * time.Millisecond, true, 6},
+		{1, 1, 133333333 * time.Nanosecond, false, 1},
+		{4, 8, 200 * time.Millisecond, false, 8},
+	}
+
+	for _, table := range tables {
+		icon, err := rc.File[table.file].Icon()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Len(t, icon.Image, table.frames)
+		assert.Len(t, icon.Delay, table.frames)
+		assert.Equal(t, table.delay, icon.Delay[0])
+		assert.Equal(t, table.pingPong, icon.PingPong)
+
+		for _, img := range icon.Image {
+			assert.Equal(t, image.Rect(0, 0, 32, 32), img.Bounds())
+		}
+
+		g := icon.GIF()
+		assert.Len(t, g.Image, table.gif)
+		assert.Len(t, g.Delay, table.gif)
+
+		assert.NoError(t, gif.EncodeAll(io.Discard, g))
+	}
+}
+
+//nolint:funlen
+func TestIconLayout(t *testing.T) {
+	t.Parallel()
+
+	// A single shared palette frame is shown but the second frame still
+	// has a format so the shared palette comes after it
+	header := gc.SaveHeader{
+		GameCode:        "GTST",
+		MakerCode:       "01",
+		Name:            "icon",
+		IconGfxFormat:   gc.IconCI8Shared | gc.IconRGB5A3<<2,
+		AnimationSpeed:  gc.Speed4,
+		ImageDataOffset: 0,
+		CommentAddress:  0xffffffff,
+		Size:            0x2000,
+	}
+
+	data := make([]byte, header.Size)
+	copy(data, bytes.Repeat([]byte{1}, 32*32))
+
+	shared := 32*32 + 32*32*2
+	data[shared+2], data[shared+3] = 0xff, 0xff
+
+	buf := new(bytes.Buffer)
+
+	w, err := gc.NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fw, err := w.CreateHeader(&header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := gc.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	icon, err := r.File[0].Icon()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, icon.Image, 1) {
+		assert.Equal(t, color.NRGBA{0xff, 0xff, 0xff, 0xff}, color.NRGBAModel.Convert(icon.Image[0].At(0, 0)))
+	}
+
+	// The image data no longer fits if it starts too close to the end
+	header.Name, header.ImageDataOffset = "late", uint32(header.Size)-uint32(shared)
+
+	_, err = w.CreateHeader(&header)
+	assert.ErrorIs(t, err, gc.ErrImageDataOffsetOutOfRange)
+}
+
+func TestReaderHeader(t *testing.T) {
+	t.Parallel()
+
+	rc, err := gc.OpenReader(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	assert.Equal(t, time.Date(2002, 5, 27, 5, 21, 16, 139216765, time.UTC), rc.FormatTime)
+	assert.Equal(t, uint32(0xffaf9444), rc.CounterBias)
+	assert.Equal(t, gc.LanguageEnglish, rc.Language)
+	assert.Equal(t, "English", rc.Language.String())
+	assert.Equal(t, uint32(0), rc.Unknown)
+	assert.Equal(t, uint16(0), rc.DeviceID)
+
+	serial1, serial2 := rc.SerialNumbers()
+	assert.Equal(t, uint32(0x949db609), serial1)
+	assert.Equal(t, uint32(0x95e03404), serial2)
 }
@@ -0,0 +1,208 @@
+package gc
+
+import (
+	"fmt"
+	"io"
+)
+
+// counters returns a valid pair of update counters for the active and
+// inactive copies of a structure, keeping the active counter. The inactive
+// counter wraps around if the active counter is zero.
+func counters(active uint16) (uint16, uint16) {
+	return active, active - 1
+}
+
+// repairChain works out the usable chain of blocks for the entry e, either by
+// following the block allocation map m or, if that has been lost, assuming
+// the blocks are contiguous. The chain stops at the first block that is
+// invalid or already claimed in allocated.
+func (mc *memoryCard) repairChain(e *entry, m *blockMap, allocated *blockMap) ([]uint16, error) {
+	var (
+		chain []uint16
+		err   error
+	)
+
+	if m != nil {
+		chain, err = m.chain(e.FirstBlock, mc.header.blocks())
+	} else {
+		for i := 0; i < int(e.FileLength); i++ {
+			b := int(e.FirstBlock) + i
+			if b < reservedBlocks || b >= mc.header.blocks() {
+				err = ErrBlockOutOfRange
+
+				break
+			}
+
+			chain = append(chain, uint16(b))
+		}
+	}
+
+	if len(chain) >= int(e.FileLength) {
+		chain, err = chain[:e.FileLength], nil
+	}
+
+	for i, b := range chain {
+		if allocated.Blocks[b-reservedBlocks] != 0 {
+			return chain[:i], ErrBlockCrossLinked
+		}
+	}
+
+	if err == nil && (len(chain) < int(e.FileLength) || len(chain) == 0) {
+		err = ErrFileLengthMismatch
+	}
+
+	return chain, err
+}
+
+//nolint:cyclop,funlen
+func (mc *memoryCard) repair() []string {
+	var changes []string
+
+	logf := func(format string, a ...interface{}) {
+		changes = append(changes, fmt.Sprintf(format, a...))
+	}
+
+	if err := mc.headerError(); err != nil {
+		logf("%v, recomputed checksum", err)
+	}
+
+	for i := 0; i < copies; i++ {
+		if err := mc.directoryError(i); err != nil {
+			mc.badDirectory[i] = true
+			logf("%v", err)
+		}
+
+		if err := mc.blockMapError(i); err != nil {
+			mc.badBlockMap[i] = true
+			logf("%v", err)
+		}
+	}
+
+	d := mc.activeDirectory()
+	if mc.badDirectory[master] && mc.badDirectory[backup] {
+		logf("no valid directory, using %s copy", copyName(d))
+	}
+
+	var m *blockMap
+	if !mc.badBlockMap[master] || !mc.badBlockMap[backup] {
+		m = &mc.blockMap[mc.activeBlockMap()]
+	} else {
+		logf("no valid block map, rebuilding chains from directory")
+	}
+
+	dir := mc.directory[d]
+
+	allocated := blockMap{}
+	highest := uint16(reservedBlocks - 1)
+
+	for i := range dir.Entries {
+		e := &dir.Entries[i]
+		if e.isEmpty() {
+			continue
+		}
+
+		chain, err := mc.repairChain(e, m, &allocated)
+
+		switch {
+		case len(chain) == 0:
+			logf("entry %d (%s): %v, dropped", i, e.name(mc.header.Encoding), err)
+			*e = newEntry()
+
+			continue
+		case len(chain) < int(e.FileLength):
+			logf("entry %d (%s): %v, truncated from %d to %d blocks", i, e.name(mc.header.Encoding), err, e.FileLength, len(chain))
+			e.FileLength = uint16(len(chain))
+		}
+
+		for j, b := range chain {
+			if j+1 < len(chain) {
+				allocated.Blocks[b-reservedBlocks] = chain[j+1]
+			} else {
+				allocated.Blocks[b-reservedBlocks] = lastBlock
+			}
+
+			if b > highest {
+				highest = b
+			}
+		}
+	}
+
+	old := mc.blockMap[mc.activeBlockMap()]
+	if m == nil {
+		old = newBlockMap(old.UpdateCounter, 0)
+	}
+
+	allocated.FreeBlocks = allocated.freeBlocks(mc.header.blocks())
+	if allocated.FreeBlocks != old.FreeBlocks {
+		logf("free blocks changed from %d to %d", old.FreeBlocks, allocated.FreeBlocks)
+	}
+
+	// Keep the existing last allocated block if it's still sensible,
+	// otherwise use the highest block allocated
+	allocated.LastAllocatedBlock = old.LastAllocatedBlock
+	if old.LastAllocatedBlock < reservedBlocks-1 || int(old.LastAllocatedBlock) >= mc.header.blocks() {
+		allocated.LastAllocatedBlock = highest
+		logf("last allocated block changed from %d to %d", old.LastAllocatedBlock, highest)
+	}
+
+	// If anything changed, or the pair of copies wasn't valid to begin
+	// with, write the same directory and block map to both copies with a
+	// valid pair of update counters
+	if dir.Entries != mc.directory[d].Entries || mc.badDirectory != [copies]bool{} || !validCounters(mc.directory[master].UpdateCounter, mc.directory[backup].UpdateCounter) {
+		active, inactive := counters(dir.UpdateCounter)
+		logf("rewrote both directory copies with update counters %d and %d", active, inactive)
+
+		mc.directory[d], mc.directory[d^1] = dir, dir
+		mc.directory[d].UpdateCounter, mc.directory[d^1].UpdateCounter = active, inactive
+	}
+
+	b := mc.activeBlockMap()
+
+	allocated.UpdateCounter = old.UpdateCounter
+	allocated.Checksum = old.Checksum
+
+	if allocated != old || mc.badBlockMap != [copies]bool{} || !validCounters(mc.blockMap[master].UpdateCounter, mc.blockMap[backup].UpdateCounter) {
+		active, inactive := counters(old.UpdateCounter)
+		logf("rewrote both block map copies with update counters %d and %d", active, inactive)
+
+		mc.blockMap[b], mc.blockMap[b^1] = allocated, allocated
+		mc.blockMap[b].UpdateCounter, mc.blockMap[b^1].UpdateCounter = active, inactive
+	}
+
+	mc.badDirectory = [copies]bool{}
+	mc.badBlockMap = [copies]bool{}
+
+	_ = mc.checksum()
+
+	return changes
+}
+
+// Repair reads the possibly damaged memory card image from r, which is
+// assumed to have the given size in bytes, and writes a consistent copy of it
+// to w.
+//
+// The newest valid directory and block allocation map are used. The block
+// allocation map is rebuilt from the chains of the files in the directory, or
+// if neither block allocation map is valid the chains are assumed to be
+// contiguous runs starting at each file's first block. Files with a broken
+// chain are truncated to the usable part, or dropped if there is none. The
+// free block count and last allocated block are corrected, both copies of the
+// directory and block allocation map are rewritten with a valid pair of update
+// counters and every checksum is recomputed.
+//
+// A description of each change made is returned.
+func Repair(r io.ReaderAt, size int64, w io.Writer) ([]string, error) {
+	mc := new(memoryCard)
+
+	if err := mc.unmarshalBinary(io.NewSectionReader(r, 0, size)); err != nil {
+		return nil, err
+	}
+
+	changes := mc.repair()
+
+	if _, err := mc.WriteTo(w); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,115 @@
+package gc_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bodgit/gc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepair(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name    string
+		modify  func([]byte)
+		changes bool
+		files   int
+	}{
+		{
+			name:   "valid",
+			modify: func([]byte) {},
+			files:  7,
+		},
+		{
+			name: "loop",
+			modify: func(b []byte) {
+				// Link the first block of the second file back
+				// to itself in the active block map
+				binary.BigEndian.PutUint16(b[0x6000+0x0a+2*(8-5):], 8)
+			},
+			changes: true,
+			files:   7,
+		},
+		{
+			name: "lost block maps",
+			modify: func(b []byte) {
+				b[0x6010] ^= 0xff
+				b[0x8010] ^= 0xff
+			},
+			changes: true,
+			files:   7,
+		},
+		{
+			name: "out of range",
+			modify: func(b []byte) {
+				// Corrupt the first block of the first file in
+				// both directory copies
+				binary.BigEndian.PutUint16(b[0x2000+0x36:], 0x1000)
+				binary.BigEndian.PutUint16(b[0x4000+0x36:], 0x1000)
+			},
+			changes: true,
+			files:   6,
+		},
+	}
+
+	b, err := os.ReadFile(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.name, func(t *testing.T) {
+			t.Parallel()
+
+			image := make([]byte, len(b))
+			copy(image, b)
+
+			table.modify(image)
+
+			buf := new(bytes.Buffer)
+
+			changes, err := gc.Repair(bytes.NewReader(image), int64(len(image)), buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !table.changes {
+				assert.Empty(t, changes)
+				assert.Equal(t, image, buf.Bytes())
+
+				return
+			}
+
+			assert.NotEmpty(t, changes)
+
+			report, err := gc.Verify(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Empty(t, report.Problems)
+
+			r, err := gc.NewReader(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Len(t, r.File, table.files)
+
+			for _, f := range r.File {
+				fr, err := f.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				fr.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package gc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrInvalidSaveHeader is returned when a field of a SaveHeader can't be
+// stored in a directory entry.
+var ErrInvalidSaveHeader = errors.New("invalid save header")
+
+// A SaveHeader describes a new file to be created with CreateHeader, as an
+// alternative to supplying the 64 byte directory entry at the start of a GCI
+// file. The fields mirror those of File.
+type SaveHeader struct {
+	GameCode        string    // Four character game code
+	MakerCode       string    // Two character maker code
+	Name            string    // Filename, encoded with the memory card encoding
+	Modified        time.Time // Defaults to the current time if zero
+	BannerFormat    BannerFormat
+	IconGfxFormat   IconFormat
+	AnimationSpeed  AnimationSpeed
+	Permissions     Permission
+	CopyCounter     uint8
+	ImageDataOffset uint32 // Offset of the banner and icon within the file data, or 0xffffffff
+	CommentAddress  uint32 // Offset of the comments within the file data, or 0xffffffff
+	Size            int64  // Size of the file data in bytes, a multiple of 8 KiB
+}
+
+// entry validates the SaveHeader and returns the equivalent directory entry,
+// with the filename encoded using the given memory card encoding.
+//
+//nolint:cyclop,funlen
+func (h *SaveHeader) entry(encoding uint16) (*entry, error) {
+	e := newEntry()
+
+	if len(h.GameCode) != len(e.GameCode) {
+		return nil, fmt.Errorf("%w: game code %q is not %d bytes", ErrInvalidSaveHeader, h.GameCode, len(e.GameCode))
+	}
+
+	if len(h.MakerCode) != len(e.MakerCode) {
+		return nil, fmt.Errorf("%w: maker code %q is not %d bytes", ErrInvalidSaveHeader, h.MakerCode, len(e.MakerCode))
+	}
+
+	name, err := EncodeString(encoding, h.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(name) == 0:
+		return nil, fmt.Errorf("%w: empty filename", ErrInvalidName)
+	case len(name) > filenameSize:
+		return nil, fmt.Errorf("%w: %q is longer than %d bytes", ErrInvalidName, h.Name, filenameSize)
+	}
+
+	modified := h.Modified
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+
+	seconds := modified.Sub(epoch) / time.Second
+	if seconds < 0 || seconds > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: modification time %v out of range", ErrInvalidSaveHeader, h.Modified)
+	}
+
+	if h.Size <= 0 || h.Size%blockSize != 0 || h.Size/blockSize > math.MaxUint16 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrInvalidLength, h.Size)
+	}
+
+	copy(e.GameCode[:], h.GameCode)
+	copy(e.MakerCode[:], h.MakerCode)
+
+	e.Filename = [filenameSize]byte{}
+	copy(e.Filename[:], name)
+
+	e.LastModified = uint32(seconds)
+	e.BannerFormat = h.BannerFormat
+	e.IconGfxFormat = h.IconGfxFormat
+	e.AnimationSpeed = h.AnimationSpeed
+	e.Permissions = h.Permissions
+	e.CopyCounter = h.CopyCounter
+	e.FileLength = uint16(h.Size / blockSize)
+	e.ImageDataOffset = h.ImageDataOffset
+	e.CommentAddress = h.CommentAddress
+
+	if !e.imageDataInRange() {
+		return nil, fmt.Errorf("%w: %#x", ErrImageDataOffsetOutOfRange, e.ImageDataOffset)
+	}
+
+	if !e.commentInRange() {
+		return nil, fmt.Errorf("%w: %#x", ErrCommentAddressOutOfRange, e.CommentAddress)
+	}
+
+	return &e, nil
+}
+
+// createHeader returns a new fileWriter for just the data of the file
+// described by h, the directory entry is written on its behalf. The lock must
+// be held.
+func (c *core) createHeader(h *SaveHeader) (*fileWriter, error) {
+	e, err := h.entry(c.mc.header.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.mc.conflicts(e, -1) {
+		return nil, ErrDuplicateName
+	}
+
+	if _, ok := c.mc.freeSlot(); !ok || e.FileLength > c.mc.blockMap[c.mc.activeBlockMap()].FreeBlocks {
+		return nil, ErrNoFreeSpace
+	}
+
+	b, err := e.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	fw := c.create(nil)
+	_, _ = fw.buf.Write(b)
+
+	return fw, nil
+}
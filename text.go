@@ -0,0 +1,174 @@
+package gc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bodgit/gc/internal/cp1252"
+	"github.com/bodgit/gc/internal/sjis"
+)
+
+var (
+	// ErrInvalidName is returned when an escaped filename is malformed or
+	// too long.
+	ErrInvalidName = errors.New("invalid name")
+	// ErrUnrepresentable is returned when a string contains a character
+	// that cannot be represented in the memory card encoding.
+	ErrUnrepresentable = errors.New("character cannot be represented")
+)
+
+func decodeRune(encoding uint16, b []byte) (rune, int) {
+	if encoding == EncodingSJIS {
+		return sjis.DecodeRune(b)
+	}
+
+	return cp1252.DecodeByte(b[0]), 1
+}
+
+func appendRune(encoding uint16) func([]byte, rune) ([]byte, bool) {
+	if encoding == EncodingSJIS {
+		return sjis.AppendRune
+	}
+
+	return cp1252.AppendRune
+}
+
+// DecodeString converts the NUL terminated string b from the memory card
+// encoding to UTF-8. ANSI cards use Windows-1252 and SJIS cards use
+// Shift-JIS. Any invalid bytes are replaced with utf8.RuneError.
+func DecodeString(encoding uint16, b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+
+	if encoding == EncodingSJIS {
+		return sjis.Decode(b)
+	}
+
+	return cp1252.Decode(b)
+}
+
+// EncodeString converts the UTF-8 string s to the memory card encoding. An
+// error wrapping ErrUnrepresentable is returned if s contains a character that
+// the encoding has no equivalent for.
+func EncodeString(encoding uint16, s string) ([]byte, error) {
+	appendRune := appendRune(encoding)
+
+	b := make([]byte, 0, len(s))
+
+	for _, r := range s {
+		var ok bool
+		if b, ok = appendRune(b, r); !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnrepresentable, r)
+		}
+	}
+
+	return b, nil
+}
+
+// needsEscape returns true if r can't safely appear in an fs.FS path element.
+func needsEscape(r rune) bool {
+	return r == '%' || r == '/' || r == utf8.RuneError || unicode.IsControl(r)
+}
+
+// EscapeName converts the raw filename b, which uses the memory card encoding,
+// into a name that is always a valid fs.FS path element. Any trailing NUL
+// padding is removed. Characters that decode cleanly are kept as UTF-8, and
+// every other byte, along with any "%" or "/", is escaped as "%" followed by
+// two hexadecimal digits. The names "." and ".." are escaped in full, and an
+// empty name becomes "%00". UnescapeName reverses this.
+func EscapeName(encoding uint16, b []byte) string {
+	b = bytes.TrimRight(b, "\x00")
+
+	switch string(b) {
+	case "":
+		return "%00"
+	case ".", "..":
+		return strings.Repeat("%2E", len(b))
+	}
+
+	appendRune := appendRune(encoding)
+
+	sb := new(strings.Builder)
+	sb.Grow(len(b))
+
+	for len(b) > 0 {
+		r, size := decodeRune(encoding, b)
+
+		// Only keep characters that encode back to the same bytes
+		if e, ok := appendRune(nil, r); ok && !needsEscape(r) && bytes.Equal(e, b[:size]) {
+			sb.WriteRune(r)
+		} else {
+			for _, c := range b[:size] {
+				fmt.Fprintf(sb, "%%%02X", c)
+			}
+		}
+
+		b = b[size:]
+	}
+
+	return sb.String()
+}
+
+// UnescapeName converts name, as returned by EscapeName, back into the raw
+// filename using the memory card encoding. An error wrapping ErrInvalidName
+// is returned if name is malformed, too long, or could not have been returned
+// by EscapeName, such as "..", or one containing "/" or a control character
+// that isn't escaped. An error wrapping ErrUnrepresentable is returned if it
+// contains a character that the encoding has no equivalent for.
+//
+//nolint:cyclop
+func UnescapeName(encoding uint16, name string) ([]byte, error) {
+	switch name {
+	case "", ".", "..":
+		return nil, fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+
+	appendRune := appendRune(encoding)
+
+	b := make([]byte, 0, len(name))
+
+	for i := 0; i < len(name); {
+		if name[i] == '%' {
+			if i+3 > len(name) {
+				return nil, fmt.Errorf("%w: truncated escape in %q", ErrInvalidName, name)
+			}
+
+			c, err := strconv.ParseUint(name[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("%w: bad escape in %q", ErrInvalidName, name)
+			}
+
+			b, i = append(b, byte(c)), i+3
+
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(name[i:])
+		if r == utf8.RuneError && size == 1 {
+			return nil, fmt.Errorf("%w: invalid UTF-8 in %q", ErrInvalidName, name)
+		}
+
+		if needsEscape(r) {
+			return nil, fmt.Errorf("%w: unescaped %q in %q", ErrInvalidName, r, name)
+		}
+
+		var ok bool
+		if b, ok = appendRune(b, r); !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnrepresentable, r)
+		}
+
+		i += size
+	}
+
+	if len(b) > filenameSize {
+		return nil, fmt.Errorf("%w: %q is longer than %d bytes", ErrInvalidName, name, filenameSize)
+	}
+
+	return b, nil
+}
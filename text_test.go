@@ -0,0 +1,328 @@
+package gc_test
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/bodgit/gc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeString(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name     string
+		encoding uint16
+		input    string
+		want     []byte
+		err      error
+	}{
+		{
+			name:     "ansi",
+			encoding: gc.EncodingANSI,
+			input:    "Café €5",
+			want:     []byte{'C', 'a', 'f', 0xe9, ' ', 0x80, '5'},
+		},
+		{
+			name:     "ansi unrepresentable",
+			encoding: gc.EncodingANSI,
+			input:    "ゼルダ",
+			err:      gc.ErrUnrepresentable,
+		},
+		{
+			name:     "sjis",
+			encoding: gc.EncodingSJIS,
+			input:    "ゼルダ01",
+			want:     []byte{0x83, 0x5b, 0x83, 0x8b, 0x83, 0x5f, '0', '1'},
+		},
+		{
+			name:     "sjis unrepresentable",
+			encoding: gc.EncodingSJIS,
+			input:    "Café",
+			err:      gc.ErrUnrepresentable,
+		},
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.name, func(t *testing.T) {
+			t.Parallel()
+
+			b, err := gc.EncodeString(table.encoding, table.input)
+			if table.err != nil {
+				assert.ErrorIs(t, err, table.err)
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, table.want, b)
+			assert.Equal(t, table.input, gc.DecodeString(table.encoding, append(b, 0, 0xff)))
+		})
+	}
+}
+
+func TestSJISFilename(t *testing.T) {
+	t.Parallel()
+
+	rc, err := gc.OpenReader(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	fr, err := rc.File[2].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fr.Close()
+
+	b, err := io.ReadAll(fr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := gc.EncodeString(gc.EncodingSJIS, "ゼルダ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the filename in the header
+	copy(b[0x08:0x28], make([]byte, 0x20))
+	copy(b[0x08:], name)
+
+	buf := new(bytes.Buffer)
+
+	w, err := gc.NewWriter(buf, gc.CardSize(rc.CardSize), gc.Encoding(gc.EncodingSJIS))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fw, err := w.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := gc.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, r.File, 1) {
+		assert.Equal(t, "ゼルダ", r.File[0].Name)
+	}
+
+	f, err := r.Open("ゼルダ")
+	if assert.NoError(t, err) {
+		f.Close()
+	}
+}
+
+func TestEscapeName(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name     string
+		encoding uint16
+		input    []byte
+		want     string
+	}{
+		{
+			name:     "plain",
+			encoding: gc.EncodingANSI,
+			input:    []byte("gczelda\x00\x00\x00"),
+			want:     "gczelda",
+		},
+		{
+			name:     "slash and percent",
+			encoding: gc.EncodingANSI,
+			input:    []byte("100%/save"),
+			want:     "100%25%2Fsave",
+		},
+		{
+			name:     "dot",
+			encoding: gc.EncodingANSI,
+			input:    []byte("."),
+			want:     "%2E",
+		},
+		{
+			name:     "dot dot",
+			encoding: gc.EncodingANSI,
+			input:    []byte(".."),
+			want:     "%2E%2E",
+		},
+		{
+			name:     "empty",
+			encoding: gc.EncodingANSI,
+			input:    []byte{0, 0},
+			want:     "%00",
+		},
+		{
+			name:     "embedded nul",
+			encoding: gc.EncodingANSI,
+			input:    []byte("ab\x00cd\x00"),
+			want:     "ab%00cd",
+		},
+		{
+			name:     "windows-1252",
+			encoding: gc.EncodingANSI,
+			input:    []byte{'C', 'a', 'f', 0xe9, 0x81},
+			want:     "Café%81",
+		},
+		{
+			name:     "sjis",
+			encoding: gc.EncodingSJIS,
+			input:    []byte{0x83, 0x5b, 0x83, 0x8b, 0x83, 0x5f},
+			want:     "ゼルダ",
+		},
+		{
+			name:     "invalid sjis",
+			encoding: gc.EncodingSJIS,
+			input:    []byte{'A', 0x82, 0x20, 0x82},
+			want:     "A%82 %82",
+		},
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := gc.EscapeName(table.encoding, table.input)
+			assert.Equal(t, table.want, name)
+			assert.True(t, fs.ValidPath(name))
+
+			b, err := gc.UnescapeName(table.encoding, name)
+			if assert.NoError(t, err) {
+				want := bytes.TrimRight(table.input, "\x00")
+				if len(want) == 0 {
+					want = []byte{0}
+				}
+
+				assert.Equal(t, want, b)
+			}
+		})
+	}
+}
+
+func TestUnescapeName(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name  string
+		input string
+		err   error
+	}{
+		{"truncated", "abc%4", gc.ErrInvalidName},
+		{"bad hex", "abc%zz", gc.ErrInvalidName},
+		{"too long", "abcdefghijklmnopqrstuvwxyz0123456", gc.ErrInvalidName},
+		{"unrepresentable", "ゼルダ", gc.ErrUnrepresentable},
+		{"empty", "", gc.ErrInvalidName},
+		{"dot", ".", gc.ErrInvalidName},
+		{"dot dot", "..", gc.ErrInvalidName},
+		{"slash", "a/b", gc.ErrInvalidName},
+		{"control", "a\nb", gc.ErrInvalidName},
+		{"replacement", "a\ufffdb", gc.ErrInvalidName},
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := gc.UnescapeName(gc.EncodingANSI, table.input)
+			assert.ErrorIs(t, err, table.err)
+		})
+	}
+}
+
+func TestEscapedFS(t *testing.T) {
+	t.Parallel()
+
+	rc, err := gc.OpenReader(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	fr, err := rc.File[2].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fr.Close()
+
+	b, err := io.ReadAll(fr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+
+	w, err := gc.NewWriter(buf, gc.CardSize(rc.CardSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := [][]byte{[]byte("a/b"), []byte(".."), []byte("100%"), {0xff, 0x00, 0x81}}
+
+	for _, name := range names {
+		copy(b[0x08:0x28], make([]byte, 0x20))
+		copy(b[0x08:], name)
+
+		fw, err := w.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := fw.Write(b); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := gc.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"a%2Fb", "%2E%2E", "100%25", "ÿ%00%81"}
+
+	if err := fstest.TestFS(r, expected...); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, file := range r.File {
+		assert.Equal(t, expected[i], file.FileInfo().Name())
+	}
+
+	for i, name := range expected {
+		raw, err := gc.UnescapeName(r.Encoding, name)
+		if assert.NoError(t, err) {
+			assert.Equal(t, names[i], raw)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package gc
+
+// A DeletedFile is a file that is no longer in the memory card directory but
+// is still described by the older, inactive copy of the directory. Opening it
+// follows the chain of blocks in the inactive copy of the block allocation map.
+type DeletedFile struct {
+	*File
+
+	// ReusedBlocks is the number of the file's blocks that have since been
+	// allocated to another file.
+	ReusedBlocks int
+
+	// Recoverable is true if the chain of blocks is intact and none of
+	// them have been reused, so the file contents should be unchanged.
+	Recoverable bool
+}
+
+func (e *entry) sameFile(x *entry) bool {
+	return e.GameCode == x.GameCode && e.MakerCode == x.MakerCode && e.Filename == x.Filename
+}
+
+// Deleted returns the files described by the inactive copy of the directory
+// that are missing from the active copy. These are typically files that have
+// just been deleted. The contents can be read with Open and copied to a new
+// memory card image with Writer.Create.
+//
+// Nothing is returned if either inactive copy was damaged and skipped by the
+// Lenient option.
+func (r *Reader) Deleted() []*DeletedFile {
+	mc := r.mc
+
+	d, m := mc.activeDirectory(), mc.activeBlockMap()
+	if mc.badDirectory[d^1] || mc.badBlockMap[m^1] {
+		return nil
+	}
+
+	active := &mc.directory[d]
+
+	var deleted []*DeletedFile
+
+entries:
+	for slot, e := range mc.directory[d^1].Entries {
+		if e.isEmpty() {
+			continue
+		}
+
+		for i := range active.Entries {
+			if active.Entries[i].sameFile(&e) {
+				continue entries
+			}
+		}
+
+		df := &DeletedFile{File: r.newFile(e, slot, d^1, m^1)}
+
+		chain, err := mc.blockMap[m^1].chain(e.FirstBlock, mc.header.blocks())
+
+		for _, b := range chain {
+			if mc.blockMap[m].Blocks[b-reservedBlocks] != 0 {
+				df.ReusedBlocks++
+			}
+		}
+
+		df.Recoverable = err == nil && len(chain) == int(e.FileLength) && df.ReusedBlocks == 0
+
+		deleted = append(deleted, df)
+	}
+
+	return deleted
+}
@@ -0,0 +1,159 @@
+package gc
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// deleteFile simulates a console deleting the file in slot i by writing the
+// updated directory and block allocation map to the inactive copies.
+func deleteFile(mc *memoryCard, i int) {
+	d, m := mc.activeDirectory(), mc.activeBlockMap()
+
+	dir, bmap := mc.directory[d], mc.blockMap[m]
+
+	chain, _ := bmap.chain(dir.Entries[i].FirstBlock, mc.header.blocks())
+	for _, b := range chain {
+		bmap.Blocks[b-reservedBlocks] = 0
+		bmap.FreeBlocks++
+	}
+
+	dir.Entries[i] = newEntry()
+
+	dir.UpdateCounter++
+	bmap.UpdateCounter++
+
+	mc.directory[d^1], mc.blockMap[m^1] = dir, bmap
+
+	_ = mc.checksum()
+}
+
+//nolint:funlen
+func TestDeleted(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name        string
+		reuse       bool
+		damaged     bool
+		recoverable bool
+	}{
+		{
+			name:        "recoverable",
+			recoverable: true,
+		},
+		{
+			name:  "reused",
+			reuse: true,
+		},
+		{
+			name:    "damaged",
+			damaged: true,
+		},
+	}
+
+	image, err := os.ReadFile(filepath.Join("testdata", "patches.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.name, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := NewReader(bytes.NewReader(image))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected, err := fs.ReadFile(r, "PSO_CHARACTER")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mc := new(memoryCard)
+			if err := mc.UnmarshalBinary(image); err != nil {
+				t.Fatal(err)
+			}
+
+			deleteFile(mc, 2)
+
+			if table.reuse {
+				m := &mc.blockMap[mc.activeBlockMap()]
+				m.Blocks[mc.directory[master].Entries[2].FirstBlock-reservedBlocks] = lastBlock
+				m.FreeBlocks--
+				_ = m.checksum()
+			}
+
+			if table.damaged {
+				d := &mc.directory[mc.activeDirectory()^1]
+				d.Checksum[checksumNormal][0]++
+			}
+
+			b, err := mc.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err = NewReader(bytes.NewReader(b), Lenient())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Len(t, r.File, 6)
+
+			if table.damaged {
+				assert.Len(t, r.Skipped, 1)
+				assert.Empty(t, r.Deleted())
+
+				return
+			}
+
+			deleted := r.Deleted()
+			if !assert.Len(t, deleted, 1) {
+				return
+			}
+
+			assert.Equal(t, "PSO_CHARACTER", deleted[0].Name)
+			assert.Equal(t, table.recoverable, deleted[0].Recoverable)
+
+			if !table.recoverable {
+				assert.Equal(t, 1, deleted[0].ReusedBlocks)
+
+				return
+			}
+
+			fr, err := deleted[0].Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fr.Close()
+
+			w, err := NewWriter(io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fw, err := w.Create()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual, err := io.ReadAll(io.TeeReader(fr, fw))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, expected, actual)
+			assert.Nil(t, fw.Close())
+			assert.Nil(t, w.Close())
+		})
+	}
+}
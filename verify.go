@@ -0,0 +1,171 @@
+package gc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrBlockCrossLinked is returned when a block is used by more than
+	// one file.
+	ErrBlockCrossLinked = errors.New("block used by more than one file")
+	// ErrCommentAddressOutOfRange is returned when the comments for a file
+	// lie beyond the end of it.
+	ErrCommentAddressOutOfRange = errors.New("comment address out of range")
+	// ErrFreeBlocksMismatch is returned when the free block count of a
+	// block allocation map doesn't match the number of unallocated blocks.
+	ErrFreeBlocksMismatch = errors.New("free blocks do not match block map")
+	// ErrImageDataOffsetOutOfRange is returned when the banner and icon
+	// data for a file lie beyond the end of it.
+	ErrImageDataOffsetOutOfRange = errors.New("image data offset out of range")
+	// ErrLastAllocatedOutOfRange is returned when the last allocated block
+	// of a block allocation map lies outside the card.
+	ErrLastAllocatedOutOfRange = errors.New("last allocated block out of range")
+)
+
+const (
+	commentSize = 0x40
+	noOffset    = 0xffffffff
+)
+
+// A Report lists every problem found when verifying a memory card image. Each
+// problem is a *CorruptionError.
+type Report struct {
+	Problems []error
+}
+
+// OK returns true if no problems were found.
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *Report) add(err error) {
+	if err != nil {
+		r.Problems = append(r.Problems, err)
+	}
+}
+
+func (mc *memoryCard) verify() *Report {
+	report := new(Report)
+
+	report.add(mc.headerError())
+
+	// As with salvage, the entries are checked against the undamaged copies
+	// wherever possible
+	badDirectory, badBlockMap := mc.badDirectory, mc.badBlockMap
+
+	for i := 0; i < copies; i++ {
+		if err := mc.directoryError(i); err != nil {
+			badDirectory[i] = true
+
+			report.add(err)
+		}
+
+		if err := mc.blockMapError(i); err != nil {
+			badBlockMap[i] = true
+
+			report.add(err)
+		}
+	}
+
+	report.add(mc.directoryCountersError())
+	report.add(mc.blockMapCountersError())
+
+	for i := 0; i < copies; i++ {
+		mc.verifyBlockMap(report, i)
+	}
+
+	mc.verifyEntries(report, active(badDirectory, mc.directoryCounters()), active(badBlockMap, mc.blockMapCounters()))
+
+	return report
+}
+
+func (mc *memoryCard) verifyBlockMap(report *Report, i int) {
+	m := &mc.blockMap[i]
+
+	if free := m.freeBlocks(mc.header.blocks()); m.FreeBlocks != free {
+		report.add(newCorruptionError(StructureBlockMap, i, -1, blockMapFreeBlocksOffset,
+			fmt.Errorf("%w: %d, expected %d", ErrFreeBlocksMismatch, m.FreeBlocks, free)))
+	}
+
+	if m.LastAllocatedBlock < reservedBlocks-1 || int(m.LastAllocatedBlock) >= mc.header.blocks() {
+		report.add(newCorruptionError(StructureBlockMap, i, -1, blockMapLastAllocatedOffset,
+			fmt.Errorf("%w: %d", ErrLastAllocatedOutOfRange, m.LastAllocatedBlock)))
+	}
+}
+
+// chainError locates the problem err found after following chain, the blocks
+// for directory entry i, either in the entry itself or in the link from the
+// last good block in the block allocation map.
+func (mc *memoryCard) chainError(d, m, i int, chain []uint16, err error) *CorruptionError {
+	if len(chain) == 0 {
+		return newCorruptionError(StructureDirectory, d, i, entryOffset(i, entryFirstBlockOffset), err)
+	}
+
+	return newCorruptionError(StructureBlockMap, m, i, linkOffset(chain[len(chain)-1]), err)
+}
+
+// verifyEntries checks the entries in directory copy d against block map copy
+// m.
+func (mc *memoryCard) verifyEntries(report *Report, d, m int) {
+	owners := make(map[uint16]int)
+
+	for i := range mc.directory[d].Entries {
+		e := &mc.directory[d].Entries[i]
+		if e.isEmpty() {
+			continue
+		}
+
+		chain, err := mc.blockMap[m].chain(e.FirstBlock, mc.header.blocks())
+		if err != nil {
+			report.add(mc.chainError(d, m, i, chain, err))
+		}
+
+		for j, b := range chain {
+			if owner, ok := owners[b]; ok {
+				report.add(mc.chainError(d, m, i, chain[:j],
+					fmt.Errorf("%w: block %d also used by entry %d", ErrBlockCrossLinked, b, owner)))
+
+				continue
+			}
+
+			owners[b] = i
+		}
+
+		if err == nil && len(chain) != int(e.FileLength) {
+			report.add(newCorruptionError(StructureDirectory, d, i, entryOffset(i, entryFileLengthOffset),
+				fmt.Errorf("%w: %d blocks, expected %d", ErrFileLengthMismatch, len(chain), e.FileLength)))
+		}
+
+		if !e.imageDataInRange() {
+			report.add(newCorruptionError(StructureDirectory, d, i, entryOffset(i, entryImageDataOffset),
+				fmt.Errorf("%w: %#x", ErrImageDataOffsetOutOfRange, e.ImageDataOffset)))
+		}
+
+		if !e.commentInRange() {
+			report.add(newCorruptionError(StructureDirectory, d, i, entryOffset(i, entryCommentAddressOffset),
+				fmt.Errorf("%w: %#x", ErrCommentAddressOutOfRange, e.CommentAddress)))
+		}
+	}
+}
+
+// Verify checks the memory card image read from r, which is assumed to have
+// the given size in bytes, and returns a Report of every problem found rather
+// than stopping at the first one. An error is only returned if the image is
+// too damaged to be examined at all.
+func Verify(r io.ReaderAt, size int64) (*Report, error) {
+	mc := new(memoryCard)
+
+	if err := mc.unmarshalBinaryAt(r, size); err != nil {
+		return nil, err
+	}
+
+	return mc.verify(), nil
+}
+
+// Verify checks the memory card image and returns a Report of every problem
+// found.
+func (r *Reader) Verify() *Report {
+	return r.mc.verify()
+}
@@ -0,0 +1,198 @@
+package gc_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bodgit/gc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		file string
+	}{
+		{
+			filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"),
+		},
+		{
+			filepath.Join("testdata", "blank.mcd"),
+		},
+		{
+			filepath.Join("testdata", "patches.raw"),
+		},
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.file, func(t *testing.T) {
+			t.Parallel()
+
+			b, err := os.ReadFile(table.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := gc.Verify(bytes.NewReader(b), int64(len(b)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Empty(t, report.Problems)
+			assert.True(t, report.OK())
+		})
+	}
+}
+
+func TestVerifyDamaged(t *testing.T) {
+	t.Parallel()
+
+	b, err := os.ReadFile(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Damage the master directory checksum, link the first block of the
+	// second file in the active block map back to itself and break the
+	// free block count in the backup block map
+	b[0x2000+0x1ffc] ^= 0xff
+	binary.BigEndian.PutUint16(b[0x6000+0x0a+2*(8-5):], 8)
+	binary.BigEndian.PutUint16(b[0x8000+0x06:], 0)
+
+	report, err := gc.Verify(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Master directory checksum, both block map checksums, backup free
+	// blocks and the loop in the second file
+	assert.Len(t, report.Problems, 5)
+	assert.False(t, report.OK())
+
+	var target *gc.CorruptionError
+	if assert.ErrorAs(t, report.Problems[4], &target) {
+		assert.ErrorIs(t, target, gc.ErrBlockChainLoop)
+		assert.Equal(t, gc.StructureBlockMap, target.Structure)
+		assert.Equal(t, gc.CopyMaster, target.Copy)
+		assert.Equal(t, int64(0x6010), target.Offset)
+		assert.Equal(t, 1, target.Entry)
+	}
+}
+
+func TestVerifyDamagedNewer(t *testing.T) {
+	t.Parallel()
+
+	b, err := os.ReadFile(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Break the first block of the second file in the newer directory
+	// without fixing the checksum
+	newer, offset := gc.CopyMaster, 0x2000
+	if int16(binary.BigEndian.Uint16(b[0x4000+0x1ffa:])-binary.BigEndian.Uint16(b[0x2000+0x1ffa:])) > 0 {
+		newer, offset = gc.CopyBackup, 0x4000
+	}
+
+	binary.BigEndian.PutUint16(b[offset+0x40+0x36:], 0)
+
+	report, err := gc.Verify(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the checksum is reported as the entries are checked using the
+	// older, undamaged directory
+	if !assert.Len(t, report.Problems, 1) {
+		return
+	}
+
+	var target *gc.CorruptionError
+	if assert.ErrorAs(t, report.Problems[0], &target) {
+		assert.ErrorIs(t, target, gc.ErrBadDirectoryChecksum)
+		assert.Equal(t, newer, target.Copy)
+	}
+}
+
+func TestCorruptionError(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name   string
+		modify func([]byte)
+		err    error
+		target gc.CorruptionError
+	}{
+		{
+			name: "capacity",
+			modify: func(b []byte) {
+				binary.BigEndian.PutUint16(b[0x22:], 3)
+			},
+			err: gc.ErrInvalidCapacity,
+			target: gc.CorruptionError{
+				Structure: gc.StructureHeader,
+				Offset:    0x22,
+				Entry:     -1,
+			},
+		},
+		{
+			name: "backup directory",
+			modify: func(b []byte) {
+				b[0x4020] ^= 0xff
+			},
+			err: gc.ErrBadDirectoryChecksum,
+			target: gc.CorruptionError{
+				Structure: gc.StructureDirectory,
+				Copy:      gc.CopyBackup,
+				Offset:    0x5ffc,
+				Entry:     -1,
+			},
+		},
+		{
+			name: "backup block map",
+			modify: func(b []byte) {
+				b[0x8010] ^= 0xff
+			},
+			err: gc.ErrBadBlockMapChecksum,
+			target: gc.CorruptionError{
+				Structure: gc.StructureBlockMap,
+				Copy:      gc.CopyBackup,
+				Offset:    0x8000,
+				Entry:     -1,
+			},
+		},
+	}
+
+	b, err := os.ReadFile(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.name, func(t *testing.T) {
+			t.Parallel()
+
+			image := make([]byte, len(b))
+			copy(image, b)
+
+			table.modify(image)
+
+			_, err := gc.NewReader(bytes.NewReader(image))
+			assert.ErrorIs(t, err, table.err)
+
+			var target *gc.CorruptionError
+			if assert.ErrorAs(t, err, &target) {
+				assert.Equal(t, table.target.Structure, target.Structure)
+				assert.Equal(t, table.target.Copy, target.Copy)
+				assert.Equal(t, table.target.Offset, target.Offset)
+				assert.Equal(t, table.target.Entry, target.Entry)
+			}
+		})
+	}
+}
@@ -6,31 +6,39 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"sync"
 	"time"
 )
 
 var (
-	errDuplicateName = errors.New("duplicate name")
-	errInvalidLength = errors.New("invalid length")
-	errNoFreeSpace   = errors.New("no free space")
+	// ErrDuplicateName is returned when creating a file with the same name
+	// as an existing file.
+	ErrDuplicateName = errors.New("duplicate name")
+	// ErrInvalidLength is returned when the length of a file doesn't match
+	// its header or exceeds the capacity of the card.
+	ErrInvalidLength = errors.New("invalid length")
+	// ErrNoFreeSpace is returned when there are no free blocks or directory
+	// entries left on the card.
+	ErrNoFreeSpace = errors.New("no free space")
 )
 
 type fileWriter struct {
 	buf *bytes.Buffer
-	w   *Writer
+	c   *core
+	old *entry // The file being replaced, if any
 }
 
 func (w *fileWriter) maxSize() int {
 	// Maximum file size is the size of the card plus the size of the
 	// directory entry, (i.e. .gci header), minus the reserved block size
-	return w.w.mc.size() + binary.Size(entry{}) - reservedBlocks*blockSize
+	return w.c.mc.size() + binary.Size(entry{}) - reservedBlocks*blockSize
 }
 
 func (w *fileWriter) Write(p []byte) (int, error) {
 	if len(p)+w.buf.Len() > w.maxSize() {
 		// Would exceed the maximum size
-		return 0, errInvalidLength
+		return 0, ErrInvalidLength
 	}
 
 	return w.buf.Write(p) //nolint:wrapcheck
@@ -43,36 +51,59 @@ var gamePatches = map[string]func(io.Reader, *memoryCard) (io.Reader, error){
 	"PSO3_SYSTEM": patchPSO3,
 }
 
-//nolint:cyclop,funlen
 func (w *fileWriter) Close() error {
-	w.w.mu.Lock()
-	defer w.w.mu.Unlock()
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+
+	return w.close()
+}
 
-	delete(w.w.fw, w)
+//nolint:cyclop,funlen
+func (w *fileWriter) close() error {
+	delete(w.c.fw, w)
 
-	mc := w.w.mc
+	mc := w.c.mc
 
 	e := new(entry)
 	if err := binary.Read(w.buf, binary.BigEndian, e); err != nil {
 		return fmt.Errorf("unable to read header: %w", err)
 	}
 
-	for _, x := range mc.directory[mc.activeDirectory()].Entries {
-		if x.isEmpty() {
-			continue
+	// Find the slot of the file being replaced, making sure it hasn't been
+	// changed in the meantime
+	slot := -1
+
+	if w.old != nil {
+		for i, x := range mc.directory[mc.activeDirectory()].Entries {
+			if x == *w.old {
+				slot = i
+
+				break
+			}
 		}
 
-		if x.filename() == e.filename() {
-			return errDuplicateName
+		if slot < 0 {
+			return fs.ErrNotExist
 		}
 	}
 
-	if w.buf.Len() != int(e.FileLength)*blockSize {
-		return errInvalidLength
+	if mc.conflicts(e, slot) {
+		return ErrDuplicateName
+	}
+
+	if w.buf.Len() != int(e.FileLength)*blockSize || e.FileLength == 0 {
+		return ErrInvalidLength
+	}
+
+	if slot < 0 {
+		var ok bool
+		if slot, ok = mc.freeSlot(); !ok {
+			return ErrNoFreeSpace
+		}
 	}
 
-	if mc.count() == maxEntries || e.FileLength > mc.blockMap[mc.activeBlockMap()].FreeBlocks {
-		return errNoFreeSpace
+	if e.FileLength > mc.blockMap[mc.activeBlockMap()].FreeBlocks {
+		return ErrNoFreeSpace
 	}
 
 	var (
@@ -87,36 +118,60 @@ func (w *fileWriter) Close() error {
 		}
 	}
 
-	// Set e.FirstBlock to the correct location
-	e.FirstBlock = mc.blockMap[mc.activeBlockMap()].LastAllocatedBlock + 1
+	return mc.addFile(slot, e, r, w.old != nil)
+}
+
+// core holds the state shared by Writer and Editor.
+type core struct {
+	mu sync.Mutex
+	mc *memoryCard
+	fw map[*fileWriter]struct{}
+}
+
+func newCore(mc *memoryCard) core {
+	return core{
+		mc: mc,
+		fw: make(map[*fileWriter]struct{}),
+	}
+}
+
+// create returns a new fileWriter, replacing the file described by old if it
+// is not nil. The lock must be held.
+func (c *core) create(old *entry) *fileWriter {
+	fw := &fileWriter{new(bytes.Buffer), c, old}
+	c.fw[fw] = struct{}{}
 
-	// Write out the blocks
-	lastBlock := e.FirstBlock + e.FileLength - reservedBlocks
-	for i := e.FirstBlock - reservedBlocks; i < lastBlock; i++ {
-		_, _ = r.Read(mc.blocks[i][:])
+	return fw
+}
 
-		if i+1 < lastBlock {
-			mc.blockMap[mc.activeBlockMap()].Blocks[i] = i + reservedBlocks + 1
-		} else {
-			mc.blockMap[mc.activeBlockMap()].Blocks[i] = 0xffff
+// closeAll closes any open files. The lock must be held.
+func (c *core) closeAll() error {
+	for fw := range c.fw {
+		if err := fw.close(); err != nil {
+			return err
 		}
 	}
 
-	mc.directory[mc.activeDirectory()].Entries[mc.count()] = *e
+	return nil
+}
+
+// save closes any open files and then writes the memory card to w. The lock
+// must be held.
+func (c *core) save(w io.Writer) error {
+	if err := c.closeAll(); err != nil {
+		return err
+	}
 
-	mc.blockMap[mc.activeBlockMap()].LastAllocatedBlock += e.FileLength
-	mc.blockMap[mc.activeBlockMap()].FreeBlocks -= e.FileLength
+	_, err := c.mc.WriteTo(w)
 
-	return mc.checksum()
+	return err
 }
 
 // A Writer is used for creating a new memory card image with files written to
 // it.
 type Writer struct {
-	mu         sync.Mutex
+	core
 	w          io.Writer
-	mc         *memoryCard
-	fw         map[*fileWriter]struct{}
 	formatTime uint64
 	flashID    [12]byte
 	cardSize   uint16
@@ -131,44 +186,46 @@ func (w *Writer) Create() (io.WriteCloser, error) {
 	defer w.mu.Unlock()
 
 	if w.mc.count() == maxEntries || w.mc.blockMap[w.mc.activeBlockMap()].FreeBlocks == 0 {
-		return nil, errNoFreeSpace
+		return nil, ErrNoFreeSpace
 	}
 
-	fw := &fileWriter{new(bytes.Buffer), w}
-	w.fw[fw] = struct{}{}
-
-	return fw, nil
+	return w.create(nil), nil
 }
 
-// Close writes out the memory card to the underlying io.Writer. Any in-flight
-// open memory card files are closed first.
-func (w *Writer) Close() error {
+// CreateHeader returns an io.WriteCloser for writing a new file on the memory
+// card described by h. Unlike Create, only the file data should be written,
+// which must be exactly h.Size bytes.
+func (w *Writer) CreateHeader(h *SaveHeader) (io.WriteCloser, error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	// Close any open files
-	for fw := range w.fw {
-		if err := fw.Close(); err != nil {
-			return err
-		}
-
-		delete(w.fw, fw)
-	}
-
-	b, err := w.mc.MarshalBinary()
+	fw, err := w.createHeader(h)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if n, err := w.w.Write(b); err != nil || n != w.mc.size() {
-		if err != nil {
-			return err //nolint:wrapcheck
-		}
+	return fw, nil
+}
 
-		return errInvalidLength
-	}
+// Copy copies each of files, typically read from another memory card, on to
+// the memory card. Files are copied in the same way as the IPL, so those with
+// PermissionNoCopy set are skipped and the copy counter is incremented,
+// unless changed by flags. The files that could not be copied are returned
+// along with the reason why.
+func (w *Writer) Copy(files []*File, flags CopyFlag) []*SkippedFile {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-	return nil
+	return w.copyFiles(files, flags)
+}
+
+// Close writes out the memory card to the underlying io.Writer. Any in-flight
+// open memory card files are closed first.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.save(w.w)
 }
 
 // Credit to libogc/gc/ogc/lwp_watchdog.h.
@@ -182,12 +239,18 @@ func now() uint64 {
 	return timerClock * 1000 * uint64(time.Now().UTC().Sub(epoch).Seconds())
 }
 
+func ticksToTime(ticks uint64) time.Time {
+	perSecond := timerClock * 1000 //nolint:gomnd
+
+	return epoch.Add(time.Duration(ticks/perSecond)*time.Second +
+		time.Duration((ticks%perSecond)*uint64(time.Second)/perSecond))
+}
+
 // NewWriter returns a Writer targeting a new blank memory card which defaults
 // to 59 block capacity, ANSI encoding and an all-zeroes Flash ID.
 func NewWriter(w io.Writer, options ...func(*Writer) error) (*Writer, error) {
 	nw := &Writer{
 		w:          w,
-		fw:         make(map[*fileWriter]struct{}),
 		formatTime: now(),
 		cardSize:   MemoryCard59,
 	}
@@ -201,7 +264,7 @@ func NewWriter(w io.Writer, options ...func(*Writer) error) (*Writer, error) {
 		return nil, err
 	}
 
-	nw.mc = mc
+	nw.core = newCore(mc)
 
 	return nw, nil
 }
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/bodgit/gc"
 	"github.com/stretchr/testify/assert"
@@ -67,6 +68,49 @@ func TestCopy(t *testing.T) {
 	assert.Nil(t, fw.Close())
 }
 
+func TestCloseOpenFile(t *testing.T) {
+	t.Parallel()
+
+	rc, err := gc.OpenReader(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	b, err := rc.ReadFile("gczelda")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+
+	wc, err := gc.NewWriter(buf, gc.CardSize(rc.CardSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fw, err := wc.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is closed along with the card
+	if err := wc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := gc.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, r.File, 1)
+}
+
 func ExampleWriter() {
 	buf := new(bytes.Buffer)
 
@@ -82,3 +126,200 @@ func ExampleWriter() {
 	fmt.Println(buf.Len())
 	// Output: 524288
 }
+
+type shortWriter struct{}
+
+func (shortWriter) Write(p []byte) (int, error) {
+	return len(p) / 2, nil
+}
+
+func TestShortWrite(t *testing.T) {
+	t.Parallel()
+
+	w, err := gc.NewWriter(shortWriter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.ErrorIs(t, w.Close(), io.ErrShortWrite)
+}
+
+//nolint:funlen
+func TestCreateHeader(t *testing.T) {
+	t.Parallel()
+
+	r, err := gc.OpenReader(filepath.Join("testdata", "0251b_2020_04Apr_01_05-02-47.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	f := r.File[2]
+
+	gci, err := r.ReadFile(f.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := gc.SaveHeader{
+		GameCode:        f.GameCode,
+		MakerCode:       f.MakerCode,
+		Name:            f.Name,
+		Modified:        f.Modified,
+		BannerFormat:    f.BannerFormat,
+		IconGfxFormat:   f.IconGfxFormat,
+		AnimationSpeed:  f.AnimationSpeed,
+		Permissions:     f.Permissions,
+		CopyCounter:     f.CopyCounter,
+		ImageDataOffset: f.ImageDataOffset,
+		CommentAddress:  f.CommentAddress,
+		Size:            int64(f.FileLength) * 0x2000,
+	}
+
+	buf := new(bytes.Buffer)
+
+	w, err := gc.NewWriter(buf, gc.CardSize(r.CardSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fw, err := w.CreateHeader(&header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fw.Write(gci[0x40:]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tables := []struct {
+		name   string
+		modify func(*gc.SaveHeader)
+		err    error
+	}{
+		{"duplicate", func(h *gc.SaveHeader) {}, gc.ErrDuplicateName},
+		{"game code", func(h *gc.SaveHeader) { h.GameCode = "GZL" }, gc.ErrInvalidSaveHeader},
+		{"maker code", func(h *gc.SaveHeader) { h.MakerCode = "001" }, gc.ErrInvalidSaveHeader},
+		{"empty name", func(h *gc.SaveHeader) { h.Name = "" }, gc.ErrInvalidName},
+		{"long name", func(h *gc.SaveHeader) { h.Name = "abcdefghijklmnopqrstuvwxyz0123456" }, gc.ErrInvalidName},
+		{"unrepresentable name", func(h *gc.SaveHeader) { h.Name = "ゼルダ" }, gc.ErrUnrepresentable},
+		{"modified", func(h *gc.SaveHeader) { h.Modified = time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC) }, gc.ErrInvalidSaveHeader},
+		{"size", func(h *gc.SaveHeader) { h.Size = 0x1000 }, gc.ErrInvalidLength},
+		{"no space", func(h *gc.SaveHeader) { h.Name, h.Size = "big", 0x2000*1000 }, gc.ErrNoFreeSpace},
+		{"image data", func(h *gc.SaveHeader) { h.Name, h.ImageDataOffset = "x", 0x17fff }, gc.ErrImageDataOffsetOutOfRange},
+		{"comment", func(h *gc.SaveHeader) { h.Name, h.CommentAddress = "x", 0x17fff }, gc.ErrCommentAddressOutOfRange},
+	}
+
+	for _, table := range tables {
+		h := header
+		table.modify(&h)
+
+		_, err := w.CreateHeader(&h)
+		assert.ErrorIs(t, err, table.err, table.name)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	nr, err := gc.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, nr.Verify().OK())
+
+	b, err := nr.ReadFile(f.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Everything except the first block matches
+	assert.Equal(t, gci[:0x36], b[:0x36])
+	assert.Equal(t, gci[0x38:], b[0x38:])
+}
+
+//nolint:funlen
+func TestCopyFiles(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name    string
+		file    string
+		flags   gc.CopyFlag
+		err     error
+		counter uint8
+	}{
+		{"copy", "0251b_2020_04Apr_01_05-02-47.raw", 0, nil, 2},
+		{"move", "0251b_2020_04Apr_01_05-02-47.raw", gc.CopyMove, nil, 1},
+		{"no copy", "patches.raw", 0, gc.ErrNoCopy, 0},
+		{"no move", "patches.raw", gc.CopyMove, gc.ErrNoMove, 0},
+		{"force copy", "patches.raw", gc.CopyForce, nil, 1},
+		{"force move", "patches.raw", gc.CopyForce | gc.CopyMove, nil, 0},
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.name, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := gc.OpenReader(filepath.Join("testdata", table.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			buf := new(bytes.Buffer)
+
+			w, err := gc.NewWriter(buf, gc.CardSize(r.CardSize))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			skipped := w.Copy(r.File, table.flags)
+
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			nr, err := gc.NewReader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if table.err != nil {
+				if assert.Len(t, skipped, len(r.File)) {
+					for i, s := range skipped {
+						assert.Equal(t, r.File[i], s.File)
+						assert.ErrorIs(t, s.Err, table.err)
+					}
+				}
+
+				assert.Empty(t, nr.File)
+
+				return
+			}
+
+			assert.Empty(t, skipped)
+			assert.True(t, nr.Verify().OK())
+
+			if assert.Len(t, nr.File, len(r.File)) {
+				for i, f := range nr.File {
+					assert.Equal(t, r.File[i].Name, f.Name)
+					assert.Equal(t, r.File[i].Permissions, f.Permissions)
+					assert.Equal(t, table.counter, f.CopyCounter)
+				}
+			}
+
+			// Copying the same files again is skipped as they already exist
+			skipped = w.Copy(r.File[:1], table.flags)
+			if assert.Len(t, skipped, 1) {
+				assert.ErrorIs(t, skipped[0].Err, gc.ErrDuplicateName)
+			}
+		})
+	}
+}